@@ -0,0 +1,561 @@
+// Terminal client commands (ask, chat) talking to the running daemon over IPC
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"x-ai/internal/conversation"
+	"x-ai/internal/daemon"
+	"x-ai/internal/ipc"
+)
+
+// maxRetries bounds automatic retries of retryable errors
+const maxRetries = 3
+
+// errCancelled is returned when the user interrupts a reply
+var errCancelled = errors.New("cancelled")
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// connectDaemon dials the daemon and performs the protocol handshake
+func connectDaemon() (*ipc.Conn, error) {
+	cfg, err := daemon.LoadConfig(daemon.ConfigPath())
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+
+	conn, err := ipc.Dial(cfg.SocketPath, 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("daemon is not running: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := conn.Hello(ctx, "cli"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("handshake: %w", err)
+	}
+	return conn, nil
+}
+
+// fail prints an error and exits
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+	os.Exit(1)
+}
+
+// runAsk sends a single question and streams the answer to stdout
+func runAsk(args []string) {
+	fs := flag.NewFlagSet("ask", flag.ExitOnError)
+	convID := fs.String("c", "", "Continue conversation `id`")
+	var attachments stringList
+	fs.Var(&attachments, "a", "Attach `file` (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: x-ai ask [-c id] [-a file]... question...")
+		fmt.Fprintln(os.Stderr, "       command | x-ai ask [question...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	question := strings.Join(fs.Args(), " ")
+	if stdinPiped() {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fail(fmt.Errorf("read stdin: %w", err))
+		}
+		if input := strings.TrimSpace(string(data)); input != "" {
+			question = strings.TrimSpace(question + "\n\n" + input)
+		}
+	}
+	if question == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	paths, err := absPaths(attachments)
+	if err != nil {
+		fail(err)
+	}
+
+	conn, err := connectDaemon()
+	if err != nil {
+		fail(err)
+	}
+	defer conn.Close()
+
+	_, err = runTurn(conn, *convID, question, paths)
+	fmt.Println()
+	if errors.Is(err, errCancelled) {
+		os.Exit(130)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+// runChat starts an interactive session
+func runChat(args []string) {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	convID := fs.String("c", "", "Resume conversation `id`")
+	fs.Parse(args)
+
+	conn, err := connectDaemon()
+	if err != nil {
+		fail(err)
+	}
+	defer conn.Close()
+
+	r := &repl{conn: conn}
+	if *convID != "" {
+		if err := r.load(*convID); err != nil {
+			fail(err)
+		}
+	}
+
+	fmt.Println("x-ai chat - type /help for commands, Ctrl-D to quit")
+	r.run(os.Stdin)
+}
+
+// repl is an interactive chat session
+type repl struct {
+	conn   *ipc.Conn
+	convID string
+	listed []string // Conversation IDs from the last /list
+}
+
+// run reads lines until EOF or /quit
+func (r *repl) run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), ipc.MaxMessageSize)
+
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "/") {
+			if !r.command(line) {
+				return
+			}
+			continue
+		}
+
+		convID, err := runTurn(r.conn, r.convID, line, nil)
+		if convID != "" {
+			r.convID = convID
+		}
+		fmt.Println()
+		if err != nil && !errors.Is(err, errCancelled) {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			if errors.Is(err, ipc.ErrClosed) {
+				return
+			}
+		}
+	}
+}
+
+// command runs a slash command; returns false to quit
+func (r *repl) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	var err error
+	switch name {
+	case "/quit", "/exit":
+		return false
+	case "/help":
+		fmt.Println(`Commands:
+  /new          Start a new conversation
+  /list         List recent conversations
+  /load <n|id>  Switch to a conversation (number from /list or ID)
+  /retry        Regenerate the last failed reply
+  /edit <text>  Replace your last message (the old one is kept as a branch)
+  /regen        Get another version of the last reply
+  /version <n>  Show version n of the last reply and continue from it
+  /quit         Exit`)
+	case "/new":
+		r.convID = ""
+		fmt.Println("Started a new conversation")
+	case "/list":
+		err = r.list()
+	case "/load":
+		err = r.load(r.resolve(arg))
+	case "/retry":
+		if r.convID == "" {
+			err = errors.New("no conversation to retry")
+			break
+		}
+		_, err = retryTurn(r.conn, r.convID)
+		fmt.Println()
+	case "/edit":
+		err = r.edit(arg)
+		fmt.Println()
+	case "/regen":
+		err = r.regenerate()
+		fmt.Println()
+	case "/version":
+		err = r.version(arg)
+	default:
+		err = fmt.Errorf("unknown command %s (try /help)", name)
+	}
+
+	if err != nil && !errors.Is(err, errCancelled) {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+	}
+	return true
+}
+
+// list prints recent conversations
+func (r *repl) list() error {
+	reply, err := r.call(ipc.TypeListConvs, nil)
+	if err != nil {
+		return err
+	}
+
+	var convs []*conversation.Conversation
+	if err := json.Unmarshal(reply.Payload, &convs); err != nil {
+		return fmt.Errorf("invalid conversation list: %w", err)
+	}
+
+	r.listed = r.listed[:0]
+	for i, conv := range convs {
+		marker := " "
+		if conv.ID == r.convID {
+			marker = "*"
+		}
+		fmt.Printf("%s %2d. %s  (%s)\n", marker, i+1, oneLine(conv.Title), conv.UpdatedAt.Local().Format("2006-01-02 15:04"))
+		r.listed = append(r.listed, conv.ID)
+	}
+	if len(convs) == 0 {
+		fmt.Println("No conversations yet")
+	}
+	return nil
+}
+
+// resolve maps a /list number or ID prefix to a conversation ID
+func (r *repl) resolve(arg string) string {
+	if n, err := strconv.Atoi(arg); err == nil && n >= 1 && n <= len(r.listed) {
+		return r.listed[n-1]
+	}
+	for _, id := range r.listed {
+		if strings.HasPrefix(id, arg) {
+			return id
+		}
+	}
+	return arg
+}
+
+// load switches to a conversation and prints its history
+func (r *repl) load(id string) error {
+	if id == "" {
+		return errors.New("usage: /load <n|id>")
+	}
+
+	reply, err := r.call(ipc.TypeLoadConv, ipc.ConversationPayload{ID: id})
+	if err != nil {
+		return err
+	}
+
+	var data convData
+	if err := json.Unmarshal(reply.Payload, &data); err != nil || data.Conversation == nil {
+		return errors.New("invalid conversation data")
+	}
+
+	r.convID = data.Conversation.ID
+	fmt.Printf("── %s ──\n", data.Conversation.Title)
+	for _, msg := range data.Messages {
+		printMessage(msg)
+	}
+	return nil
+}
+
+// edit replaces the last user message of the conversation with text
+func (r *repl) edit(text string) error {
+	if r.convID == "" || text == "" {
+		return errors.New("usage: /edit <text> (in a conversation)")
+	}
+
+	messages, err := r.activePath()
+	if err != nil {
+		return err
+	}
+	last := lastMessage(messages, "user")
+	if last < 0 {
+		return errors.New("no message to edit")
+	}
+
+	payload := ipc.EditMessagePayload{
+		ConversationID: r.convID,
+		MessageID:      messages[last].ID,
+		Content:        text,
+	}
+	_, err = streamReply(r.conn, ipc.TypeEditMessage, payload)
+	if err != nil {
+		return retryAfter(r.conn, ipc.TypeEditMessage, payload, err)
+	}
+	return nil
+}
+
+// regenerate streams another version of the last reply
+func (r *repl) regenerate() error {
+	if r.convID == "" {
+		return errors.New("no conversation to regenerate")
+	}
+
+	payload := ipc.RegeneratePayload{ConversationID: r.convID}
+	_, err := streamReply(r.conn, ipc.TypeRegenerate, payload)
+	if err != nil {
+		return retryAfter(r.conn, ipc.TypeRegenerate, payload, err)
+	}
+	return nil
+}
+
+// version switches the last reply to another of its versions
+func (r *repl) version(arg string) error {
+	n, err := strconv.Atoi(arg)
+	if r.convID == "" || err != nil {
+		return errors.New("usage: /version <n> (in a conversation)")
+	}
+
+	messages, err := r.activePath()
+	if err != nil {
+		return err
+	}
+	last := lastMessage(messages, "assistant")
+	if last < 0 {
+		return errors.New("no reply yet")
+	}
+
+	reply, err := r.call(ipc.TypeSwitchBranch, ipc.SwitchBranchPayload{
+		ConversationID: r.convID,
+		MessageID:      messages[last].ID,
+		Version:        n,
+	})
+	if err != nil {
+		return err
+	}
+
+	var data convData
+	if err := json.Unmarshal(reply.Payload, &data); err != nil || len(data.Messages) <= last {
+		return errors.New("invalid conversation data")
+	}
+	for _, msg := range data.Messages[last:] {
+		printMessage(msg)
+	}
+	return nil
+}
+
+// activePath loads the messages of the conversation's active branch
+func (r *repl) activePath() ([]*conversation.Message, error) {
+	reply, err := r.call(ipc.TypeLoadConv, ipc.ConversationPayload{ID: r.convID})
+	if err != nil {
+		return nil, err
+	}
+
+	var data convData
+	if err := json.Unmarshal(reply.Payload, &data); err != nil {
+		return nil, errors.New("invalid conversation data")
+	}
+	return data.Messages, nil
+}
+
+// lastMessage returns the index of the last message with role (-1 if none)
+func lastMessage(messages []*conversation.Message, role string) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// call sends a request with a short timeout
+func (r *repl) call(msgType string, payload interface{}) (*ipc.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return r.conn.Call(ctx, msgType, payload)
+}
+
+// printMessage prints a stored message
+func printMessage(msg *conversation.Message) {
+	label := "ai"
+	if msg.Role == "user" {
+		label = "you"
+	}
+	if msg.SiblingCount > 1 {
+		label += fmt.Sprintf(" [%d/%d]", msg.SiblingIndex, msg.SiblingCount)
+	}
+	fmt.Printf("%s: %s\n", label, msg.Content)
+	for _, att := range msg.Attachments {
+		fmt.Printf("     📎 %s (%s)\n", att.Name, att.MimeType)
+	}
+	fmt.Println()
+}
+
+// runTurn sends a chat message and streams the reply to stdout, retrying
+// retryable failures. Returns the conversation ID the daemon used.
+func runTurn(conn *ipc.Conn, convID, content string, attachments []string) (string, error) {
+	gotID, err := streamReply(conn, ipc.TypeChat, ipc.ChatPayload{
+		ConversationID: convID,
+		Content:        content,
+		Attachments:    attachments,
+	})
+	if gotID != "" {
+		convID = gotID
+	}
+	if err == nil || convID == "" {
+		return convID, err
+	}
+
+	// The message is stored by now, so only the reply is asked for again
+	return convID, retryAfter(conn, ipc.TypeRetry, ipc.RetryPayload{ConversationID: convID}, err)
+}
+
+// retryTurn regenerates the last failed reply of a conversation
+func retryTurn(conn *ipc.Conn, convID string) (string, error) {
+	payload := ipc.RetryPayload{ConversationID: convID}
+	_, err := streamReply(conn, ipc.TypeRetry, payload)
+	if err == nil {
+		return convID, nil
+	}
+	return convID, retryAfter(conn, ipc.TypeRetry, payload, err)
+}
+
+// retryAfter resends a failed request while the daemon reports
+// retryable errors, backing off between attempts
+func retryAfter(conn *ipc.Conn, msgType string, payload interface{}, err error) error {
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		var remote *ipc.RemoteError
+		if !errors.As(err, &remote) || !remote.Retryable {
+			return err
+		}
+
+		delay := time.Duration(remote.RetryAfter) * time.Second
+		if delay <= 0 {
+			delay = time.Duration(1<<attempt) * time.Second
+		}
+		fmt.Fprintf(os.Stderr, "\n⚠️  %s - retrying in %s (%d/%d)\n", remote.Message, delay, attempt, maxRetries)
+		time.Sleep(delay)
+
+		_, err = streamReply(conn, msgType, payload)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// streamReply sends a chat-style request and prints the streamed reply.
+// Ctrl-C cancels the request. Returns the conversation ID from the ack.
+func streamReply(conn *ipc.Conn, msgType string, payload interface{}) (string, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	req, err := conn.Request(msgType, payload)
+	if err != nil {
+		return "", err
+	}
+
+	var convID string
+	for {
+		reply, err := conn.Next(ctx)
+		if errors.Is(err, context.Canceled) {
+			return convID, cancelReply(conn, req.RequestID)
+		}
+		if err != nil {
+			return convID, err
+		}
+		if reply.RequestID != req.RequestID {
+			continue // Other requests or subscriptions
+		}
+
+		switch reply.Type {
+		case ipc.TypeAck:
+			var ack struct {
+				ConversationID string `json:"conversation_id"`
+			}
+			json.Unmarshal(reply.Payload, &ack)
+			convID = ack.ConversationID
+		case ipc.TypeQueued:
+			var queued ipc.QueuedPayload
+			json.Unmarshal(reply.Payload, &queued)
+			fmt.Fprintf(os.Stderr, "⏳ Waiting for %s turn (position %d)\n", queued.Reason, queued.Position)
+		case ipc.TypeChatChunk:
+			var chunk ipc.ChatChunkPayload
+			json.Unmarshal(reply.Payload, &chunk)
+			fmt.Print(chunk.Content)
+		case ipc.TypeChatComplete:
+			return convID, nil
+		case ipc.TypeError:
+			return convID, ipc.ReplyError(reply)
+		}
+	}
+}
+
+// cancelReply asks the daemon to cancel a request and waits for it to stop
+func cancelReply(conn *ipc.Conn, requestID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := conn.Request(ipc.TypeCancel, ipc.CancelPayload{RequestID: requestID}); err != nil {
+		return err
+	}
+
+	// Drain until the request ends so its chunks don't leak into the next turn
+	for {
+		reply, err := conn.Next(ctx)
+		if err != nil {
+			return errCancelled
+		}
+		if reply.RequestID == requestID && (reply.Type == ipc.TypeError || reply.Type == ipc.TypeChatComplete) {
+			return errCancelled
+		}
+	}
+}
+
+// stdinPiped reports whether stdin is a pipe or file rather than a terminal
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// absPaths makes attachment paths absolute (the daemon has its own working dir)
+func absPaths(paths []string) ([]string, error) {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %s: %w", p, err)
+		}
+		out = append(out, abs)
+	}
+	return out, nil
+}
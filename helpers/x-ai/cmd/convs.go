@@ -0,0 +1,600 @@
+// Conversation management commands (x-ai convs ...)
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"x-ai/internal/conversation"
+	"x-ai/internal/daemon"
+	"x-ai/internal/ipc"
+)
+
+// Conversation list sizes: what convs list shows, and how many recent
+// conversations ID prefixes are matched against
+const (
+	convListLimit    = 50
+	convResolveLimit = 500
+)
+
+// convSource reads conversations from the running daemon, or straight
+// from the database (read-only) when the daemon is not running
+type convSource interface {
+	list(filter conversation.ArchiveFilter, limit int) ([]*conversation.Conversation, error)
+	load(id string) (*conversation.Conversation, []*conversation.Message, error)
+	search(query string, limit int, includeArchived bool) ([]*conversation.SearchResult, error)
+	close()
+}
+
+// ipcSource reads conversations over IPC
+type ipcSource struct {
+	conn *ipc.Conn
+}
+
+func (s *ipcSource) call(msgType string, payload interface{}) (*ipc.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.conn.Call(ctx, msgType, payload)
+}
+
+func (s *ipcSource) list(filter conversation.ArchiveFilter, limit int) ([]*conversation.Conversation, error) {
+	reply, err := s.call(ipc.TypeListConvs, ipc.ListConvsPayload{Archived: string(filter), Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	var convs []*conversation.Conversation
+	if err := json.Unmarshal(reply.Payload, &convs); err != nil {
+		return nil, fmt.Errorf("invalid conversation list: %w", err)
+	}
+	return convs, nil
+}
+
+func (s *ipcSource) load(id string) (*conversation.Conversation, []*conversation.Message, error) {
+	reply, err := s.call(ipc.TypeLoadConv, ipc.ConversationPayload{ID: id})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var data convData
+	if err := json.Unmarshal(reply.Payload, &data); err != nil || data.Conversation == nil {
+		return nil, nil, errors.New("invalid conversation data")
+	}
+	return data.Conversation, data.Messages, nil
+}
+
+func (s *ipcSource) search(query string, limit int, includeArchived bool) ([]*conversation.SearchResult, error) {
+	reply, err := s.call(ipc.TypeSearchConvs, ipc.SearchConvsPayload{
+		Query:           query,
+		Limit:           limit,
+		IncludeArchived: includeArchived,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Results []*conversation.SearchResult `json:"results"`
+	}
+	if err := json.Unmarshal(reply.Payload, &data); err != nil {
+		return nil, fmt.Errorf("invalid search results: %w", err)
+	}
+	return data.Results, nil
+}
+
+func (s *ipcSource) close() {
+	s.conn.Close()
+}
+
+// storeSource reads conversations from a read-only database
+type storeSource struct {
+	store *conversation.Store
+}
+
+func (s *storeSource) list(filter conversation.ArchiveFilter, limit int) ([]*conversation.Conversation, error) {
+	return s.store.ListConversations(limit, filter)
+}
+
+func (s *storeSource) load(id string) (*conversation.Conversation, []*conversation.Message, error) {
+	conv, err := s.store.GetConversation(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conv == nil {
+		return nil, nil, fmt.Errorf("conversation not found: %s", id)
+	}
+
+	messages, err := s.store.GetActivePath(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conv, messages, nil
+}
+
+func (s *storeSource) search(query string, limit int, includeArchived bool) ([]*conversation.SearchResult, error) {
+	return s.store.Search(query, limit, includeArchived)
+}
+
+func (s *storeSource) close() {
+	s.store.Close()
+}
+
+// convData is the conv_data payload of load_conv
+type convData struct {
+	Conversation *conversation.Conversation `json:"conversation"`
+	Messages     []*conversation.Message    `json:"messages"`
+}
+
+// openConvSource prefers the daemon and falls back to the database
+func openConvSource() (convSource, error) {
+	if conn, err := connectDaemon(); err == nil {
+		return &ipcSource{conn: conn}, nil
+	}
+
+	cfg, err := daemon.LoadConfig(daemon.ConfigPath())
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+
+	store, err := conversation.OpenReadOnly(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr, "ℹ️  Daemon not running, reading the database directly")
+	return &storeSource{store: store}, nil
+}
+
+// runConvs dispatches x-ai convs subcommands
+func runConvs(args []string) {
+	if len(args) == 0 {
+		convsUsage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "list", "ls":
+		err = convsList(args[1:])
+	case "show":
+		err = convsShow(args[1:])
+	case "search":
+		err = convsSearch(args[1:])
+	case "export":
+		err = convsExport(args[1:])
+	case "rename":
+		err = convsRename(args[1:])
+	case "archive":
+		err = convsArchive(args[1:], true)
+	case "unarchive":
+		err = convsArchive(args[1:], false)
+	case "pin":
+		err = convsPin(args[1:], true)
+	case "unpin":
+		err = convsPin(args[1:], false)
+	case "delete", "rm":
+		err = convsDelete(args[1:])
+	case "-h", "--help", "help":
+		convsUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown convs command: %s\n", args[0])
+		convsUsage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fail(err)
+	}
+}
+
+func convsUsage() {
+	fmt.Fprintln(os.Stderr, `Usage: x-ai convs <command> [flags] [args]
+
+Commands:
+  list [--json] [--archived|--all]   List recent conversations (pinned first)
+  show [--json] <id>                 Show a conversation and its messages
+  search [--json] [-n N] [--archived] <query...>
+                                     Search messages and titles
+  export [--format md|json] <id>     Export a conversation to stdout
+  rename <id> <title...>             Rename a conversation
+  archive <id>...                    Archive conversations
+  unarchive <id>...                  Restore archived conversations
+  pin <id>...                        Keep conversations at the top of the list
+  unpin <id>...                      Unpin conversations
+  delete <id>...                     Delete conversations
+
+IDs may be shortened to any unique prefix. Reads fall back to the
+database when the daemon is not running; changes require the daemon.`)
+}
+
+// convsList prints recent conversations
+func convsList(args []string) error {
+	fs := flag.NewFlagSet("convs list", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Output JSON")
+	onlyArchived := fs.Bool("archived", false, "List archived conversations only")
+	all := fs.Bool("all", false, "Include archived conversations")
+	fs.Parse(args)
+
+	filter := conversation.ArchivedExclude
+	if *onlyArchived {
+		filter = conversation.ArchivedOnly
+	} else if *all {
+		filter = conversation.ArchivedInclude
+	}
+
+	src, err := openConvSource()
+	if err != nil {
+		return err
+	}
+	defer src.close()
+
+	convs, err := src.list(filter, convListLimit)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(convs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUPDATED\tMODEL\tTITLE")
+	for _, conv := range convs {
+		title := oneLine(conv.Title)
+		if conv.Pinned {
+			title = "📌 " + title
+		}
+		if conv.Archived {
+			title += " (archived)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", shortID(conv.ID), conv.UpdatedAt.Local().Format("2006-01-02 15:04"),
+			conv.Model, title)
+	}
+	return w.Flush()
+}
+
+// convsSearch prints ranked matches for a query
+func convsSearch(args []string) error {
+	fs := flag.NewFlagSet("convs search", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Output JSON")
+	limit := fs.Int("n", conversation.DefaultSearchLimit, "Maximum number of results")
+	archived := fs.Bool("archived", false, "Include archived conversations")
+	fs.Parse(args)
+
+	query := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		return errors.New("usage: x-ai convs search [--json] [-n N] [--archived] <query...>")
+	}
+
+	src, err := openConvSource()
+	if err != nil {
+		return err
+	}
+	defer src.close()
+
+	results, err := src.search(query, *limit, *archived)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if results == nil {
+			results = []*conversation.SearchResult{}
+		}
+		return printJSON(results)
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(os.Stderr, "No matches")
+		return nil
+	}
+
+	bold := stdoutTerminal()
+	for _, r := range results {
+		fmt.Printf("%s  %s  %s\n", shortID(r.ConversationID), r.CreatedAt.Local().Format("2006-01-02 15:04"), oneLine(r.Title))
+		if r.MessageID != "" {
+			fmt.Printf("    %s: %s\n", r.Role, highlight(oneLine(r.Snippet), bold))
+		}
+	}
+	return nil
+}
+
+// highlight renders snippet match markers as bold text on a terminal,
+// or leaves them as Markdown otherwise
+func highlight(snippet string, bold bool) string {
+	if !bold {
+		return snippet
+	}
+
+	parts := strings.Split(snippet, conversation.HighlightStart)
+	var b strings.Builder
+	for i, part := range parts {
+		if i > 0 {
+			if i%2 == 1 {
+				b.WriteString("\033[1m")
+			} else {
+				b.WriteString("\033[0m")
+			}
+		}
+		b.WriteString(part)
+	}
+	if len(parts)%2 == 0 {
+		b.WriteString("\033[0m")
+	}
+	return b.String()
+}
+
+// stdoutTerminal reports whether stdout is a terminal
+func stdoutTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// convsShow prints a conversation with its messages
+func convsShow(args []string) error {
+	fs := flag.NewFlagSet("convs show", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Output JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: x-ai convs show [--json] <id>")
+	}
+
+	src, err := openConvSource()
+	if err != nil {
+		return err
+	}
+	defer src.close()
+
+	conv, messages, err := loadConv(src, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(convData{Conversation: conv, Messages: messages})
+	}
+
+	archived, pinned := "no", "no"
+	if conv.Archived {
+		archived = "yes"
+	}
+	if conv.Pinned {
+		pinned = "yes"
+	}
+	fmt.Printf("Title:    %s\n", conv.Title)
+	fmt.Printf("ID:       %s\n", conv.ID)
+	fmt.Printf("Model:    %s (%s)\n", conv.Model, conv.Provider)
+	fmt.Printf("Created:  %s\n", conv.CreatedAt.Local().Format(time.DateTime))
+	fmt.Printf("Updated:  %s\n", conv.UpdatedAt.Local().Format(time.DateTime))
+	fmt.Printf("Archived: %s\n", archived)
+	fmt.Printf("Pinned:   %s\n", pinned)
+
+	for _, msg := range messages {
+		branch := ""
+		if msg.SiblingCount > 1 {
+			branch = fmt.Sprintf("  branch %d/%d", msg.SiblingIndex, msg.SiblingCount)
+		}
+		fmt.Printf("\n[%s] %s  %s  ~%d tokens%s\n", msg.Role, shortID(msg.ID),
+			msg.CreatedAt.Local().Format(time.DateTime), msg.TokenCount, branch)
+		fmt.Println(msg.Content)
+		for _, att := range msg.Attachments {
+			fmt.Printf("  📎 %s (%s, %d bytes) %s\n", att.Name, att.MimeType, att.Size, att.Path)
+		}
+	}
+	return nil
+}
+
+// convsExport writes a conversation as Markdown or JSON
+func convsExport(args []string) error {
+	fs := flag.NewFlagSet("convs export", flag.ExitOnError)
+	format := fs.String("format", "md", "Output `format` (md or json)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: x-ai convs export [--format md|json] <id>")
+	}
+
+	src, err := openConvSource()
+	if err != nil {
+		return err
+	}
+	defer src.close()
+
+	conv, messages, err := loadConv(src, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		return printJSON(convData{Conversation: conv, Messages: messages})
+	case "md", "markdown":
+		writeMarkdown(os.Stdout, conv, messages)
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q (use md or json)", *format)
+	}
+}
+
+// writeMarkdown renders a conversation as Markdown
+func writeMarkdown(w io.Writer, conv *conversation.Conversation, messages []*conversation.Message) {
+	fmt.Fprintf(w, "# %s\n\n", oneLine(conv.Title))
+	fmt.Fprintf(w, "_%s / %s, %s_\n", conv.Provider, conv.Model, conv.CreatedAt.Local().Format(time.DateTime))
+
+	for _, msg := range messages {
+		heading := "Assistant"
+		if msg.Role == "user" {
+			heading = "You"
+		}
+		fmt.Fprintf(w, "\n## %s\n\n%s\n", heading, strings.TrimSpace(msg.Content))
+		for _, att := range msg.Attachments {
+			fmt.Fprintf(w, "\n> 📎 %s (%s)\n", att.Name, att.MimeType)
+		}
+	}
+}
+
+// convsRename changes a conversation title
+func convsRename(args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: x-ai convs rename <id> <title...>")
+	}
+	title := strings.Join(args[1:], " ")
+
+	return withDaemon(func(src *ipcSource) error {
+		id, err := resolveConvID(src, args[0])
+		if err != nil {
+			return err
+		}
+		_, err = src.call(ipc.TypeUpdateConv, ipc.UpdateConvPayload{ID: id, Title: &title})
+		if err == nil {
+			fmt.Printf("Renamed %s to %q\n", shortID(id), title)
+		}
+		return err
+	})
+}
+
+// convsArchive archives or restores conversations
+func convsArchive(args []string, archived bool) error {
+	if len(args) == 0 {
+		return errors.New("usage: x-ai convs archive|unarchive <id>...")
+	}
+
+	action := "Archived"
+	if !archived {
+		action = "Restored"
+	}
+
+	return withDaemon(func(src *ipcSource) error {
+		for _, arg := range args {
+			id, err := resolveConvID(src, arg)
+			if err != nil {
+				return err
+			}
+			if _, err := src.call(ipc.TypeUpdateConv, ipc.UpdateConvPayload{ID: id, Archived: &archived}); err != nil {
+				return err
+			}
+			fmt.Printf("%s %s\n", action, shortID(id))
+		}
+		return nil
+	})
+}
+
+// convsPin pins or unpins conversations
+func convsPin(args []string, pinned bool) error {
+	if len(args) == 0 {
+		return errors.New("usage: x-ai convs pin|unpin <id>...")
+	}
+
+	action := "Pinned"
+	if !pinned {
+		action = "Unpinned"
+	}
+
+	return withDaemon(func(src *ipcSource) error {
+		for _, arg := range args {
+			id, err := resolveConvID(src, arg)
+			if err != nil {
+				return err
+			}
+			if _, err := src.call(ipc.TypeUpdateConv, ipc.UpdateConvPayload{ID: id, Pinned: &pinned}); err != nil {
+				return err
+			}
+			fmt.Printf("%s %s\n", action, shortID(id))
+		}
+		return nil
+	})
+}
+
+// convsDelete deletes conversations
+func convsDelete(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: x-ai convs delete <id>...")
+	}
+
+	return withDaemon(func(src *ipcSource) error {
+		for _, arg := range args {
+			id, err := resolveConvID(src, arg)
+			if err != nil {
+				return err
+			}
+			if _, err := src.call(ipc.TypeDeleteConv, ipc.ConversationPayload{ID: id}); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted %s\n", shortID(id))
+		}
+		return nil
+	})
+}
+
+// withDaemon runs a change through the daemon, which owns the database
+func withDaemon(fn func(src *ipcSource) error) error {
+	conn, err := connectDaemon()
+	if err != nil {
+		return fmt.Errorf("%w (changes go through the daemon; start it with x-ai daemon)", err)
+	}
+	src := &ipcSource{conn: conn}
+	defer src.close()
+	return fn(src)
+}
+
+// loadConv loads a conversation by full ID or unique prefix
+func loadConv(src convSource, arg string) (*conversation.Conversation, []*conversation.Message, error) {
+	id, err := resolveConvID(src, arg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return src.load(id)
+}
+
+// resolveConvID expands a unique ID prefix among recent conversations,
+// archived ones included.
+// Full IDs are used as-is.
+func resolveConvID(src convSource, arg string) (string, error) {
+	if len(arg) == len("00000000-0000-0000-0000-000000000000") {
+		return arg, nil
+	}
+
+	convs, err := src.list(conversation.ArchivedInclude, convResolveLimit)
+	if err != nil {
+		return "", err
+	}
+
+	var match string
+	for _, conv := range convs {
+		if strings.HasPrefix(conv.ID, arg) {
+			if match != "" {
+				return "", fmt.Errorf("ambiguous conversation ID %q", arg)
+			}
+			match = conv.ID
+		}
+	}
+	if match == "" {
+		return "", fmt.Errorf("no conversation matches %q", arg)
+	}
+	return match, nil
+}
+
+// printJSON writes v as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// shortID returns the first block of a UUID
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// oneLine collapses whitespace so titles fit on one line
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
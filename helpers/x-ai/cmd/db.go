@@ -0,0 +1,134 @@
+// Database maintenance commands (x-ai db ...)
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"x-ai/internal/conversation"
+	"x-ai/internal/daemon"
+)
+
+// runDB dispatches x-ai db subcommands
+func runDB(args []string) {
+	if len(args) == 0 {
+		dbUsage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "migrate":
+		err = dbMigrate(args[1:])
+	case "-h", "--help", "help":
+		dbUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown db command: %s\n", args[0])
+		dbUsage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fail(err)
+	}
+}
+
+func dbUsage() {
+	fmt.Fprintln(os.Stderr, `Usage: x-ai db <command> [flags]
+
+Commands:
+  migrate [--dry-run] [--json]       Upgrade the database schema
+
+The daemon migrates automatically on start; a backup of the database is
+written to <data dir>/db/backups before any step runs.`)
+}
+
+// dbMigrate applies (or with --dry-run lists) pending schema migrations
+func dbMigrate(args []string) error {
+	fs := flag.NewFlagSet("db migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "List pending steps without applying them")
+	asJSON := fs.Bool("json", false, "Output JSON")
+	fs.Parse(args)
+
+	cfg, err := daemon.LoadConfig(daemon.ConfigPath())
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	status, err := conversation.CheckMigrations(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		if *asJSON {
+			return printJSON(status)
+		}
+		printMigrationStatus(status)
+		return nil
+	}
+
+	if len(status.Pending) > 0 {
+		// The daemon holds the database open and migrates on start
+		if conn, err := connectDaemon(); err == nil {
+			conn.Close()
+			return errors.New("daemon is running; stop it first (it migrates the database on start)")
+		}
+	}
+
+	log.SetOutput(io.Discard) // The summary below covers the store's log lines
+	result, err := conversation.Migrate(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(result)
+	}
+	if len(result.Applied) == 0 {
+		fmt.Printf("Database is up to date (schema v%d)\n", result.To)
+		return nil
+	}
+	if result.Backup != "" {
+		fmt.Printf("Backup: %s\n", result.Backup)
+	}
+	for _, m := range result.Applied {
+		fmt.Printf("Applied %d: %s\n", m.Version, m.Name)
+	}
+	fmt.Printf("Migrated schema v%d → v%d\n", result.From, result.To)
+	return nil
+}
+
+// printMigrationStatus prints the dry-run report
+func printMigrationStatus(status *conversation.MigrationStatus) {
+	if !status.Exists {
+		fmt.Printf("No database at %s; it will be created at schema v%d\n", status.Path, status.Latest)
+		return
+	}
+
+	fmt.Printf("Database: %s\n", status.Path)
+	fmt.Printf("Schema:   v%d (this build: v%d)\n", status.Version, status.Latest)
+
+	if status.Version > status.Latest {
+		fmt.Println("The database is newer than this build; upgrade x-ai.")
+		return
+	}
+	if len(status.Pending) == 0 {
+		fmt.Println("Up to date, nothing to do.")
+		return
+	}
+
+	if status.Version == 0 {
+		fmt.Println("Unversioned database: steps already in place are only recorded.")
+	}
+	fmt.Println("Pending migrations:")
+	for _, m := range status.Pending {
+		fmt.Printf("  %d  %s\n", m.Version, m.Name)
+	}
+	fmt.Printf("A backup will be written to %s first.\n", filepath.Join(filepath.Dir(status.Path), "backups"))
+}
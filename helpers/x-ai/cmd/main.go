@@ -5,25 +5,67 @@
 //
 //	x-ai daemon    Start the daemon (normally via systemd)
 //	x-ai status    Check daemon status
+//	x-ai ask       Ask a single question
+//	x-ai chat      Interactive chat session
+//	x-ai convs     Manage conversations
 //	x-ai --help    Show help
 package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"net"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"x-ai/internal/conversation"
 	"x-ai/internal/daemon"
+	"x-ai/internal/gateway"
 	"x-ai/internal/ipc"
 	"x-ai/internal/providers"
 	"x-ai/internal/security"
 )
 
+// version is set at build time via -ldflags "-X main.version=..."
+var version = "dev"
+
+// Conversation list sizes for list_convs
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// requestTypes lists every request type the daemon accepts
+var requestTypes = []string{
+	ipc.TypeHello,
+	ipc.TypePing,
+	ipc.TypeChat,
+	ipc.TypeRetry,
+	ipc.TypeEditMessage,
+	ipc.TypeRegenerate,
+	ipc.TypeSwitchBranch,
+	ipc.TypeCancel,
+	ipc.TypeNewConv,
+	ipc.TypeLoadConv,
+	ipc.TypeListConvs,
+	ipc.TypeDeleteConv,
+	ipc.TypeUpdateConv,
+	ipc.TypeSearchConvs,
+	ipc.TypeSetProvider,
+	ipc.TypeSetModel,
+	ipc.TypeSubscribe,
+	ipc.TypeUnsubscribe,
+	ipc.TypeMonitor,
+	ipc.TypeStatus,
+}
+
 func main() {
 	log.SetFlags(log.Ltime | log.Lshortfile)
 
@@ -36,7 +78,17 @@ func main() {
 	case "daemon":
 		runDaemon()
 	case "status":
-		checkStatus()
+		checkStatus(os.Args[2:])
+	case "ask":
+		runAsk(os.Args[2:])
+	case "chat":
+		runChat(os.Args[2:])
+	case "convs":
+		runConvs(os.Args[2:])
+	case "watch":
+		runWatch(os.Args[2:])
+	case "db":
+		runDB(os.Args[2:])
 	case "test":
 		runTest()
 	case "-h", "--help", "help":
@@ -53,27 +105,45 @@ func printUsage() {
 
 Usage:
   x-ai daemon     Start the daemon
-  x-ai status     Check daemon status
+  x-ai status     Check daemon status (--json for status bars)
+  x-ai ask        Ask a question (reads stdin when piped)
+  x-ai chat       Interactive chat (/help for commands)
+  x-ai convs      List, show, export, rename, archive or delete conversations
+  x-ai watch      Show live IPC traffic (debugging)
+  x-ai db         Database maintenance (migrate [--dry-run])
   x-ai test       Run a quick test
   x-ai --help     Show this help
 
 Environment:
   OPENAI_API_KEY  OpenAI API key (required for online mode)
-  X_AI_SOCKET     Socket path (default: /tmp/x-ai.sock)
-  X_AI_DATA_DIR   Data directory (default: ~/.local/share/x-ai)`)
+  X_AI_SOCKET     Socket path (default: $XDG_RUNTIME_DIR/x-ai/x-ai.sock)
+  X_AI_DATA_DIR   Data directory (default: ~/.local/share/x-ai)
+  X_AI_HTTP_ADDR  Enable the loopback HTTP gateway on this address
+  X_AI_CONFIG     Config file (default: ~/.config/x-ai/config.json)`)
 }
 
 func runDaemon() {
 	// Load configuration
-	cfg, err := daemon.LoadConfig("")
+	cfg, err := daemon.LoadConfig(daemon.ConfigPath())
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Create daemon (owns idle tracking and in-flight requests)
+	d, err := daemon.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create daemon: %v", err)
+	}
+
 	// Create handler for IPC messages
-	handler := &Handler{cfg: cfg}
+	handler := &Handler{
+		cfg:       cfg,
+		daemon:    d,
+		requests:  d.Requests(),
+		providers: providers.NewRegistry(),
+	}
 
-	// Try to initialize a provider (Gemini first since it has free tier, then OpenAI)
+	// Initialize every provider we have a key for (Gemini first since it has free tier, then OpenAI)
 	ctx := context.Background()
 
 	// Try Gemini first (free tier available!)
@@ -88,39 +158,60 @@ func runDaemon() {
 		if err != nil {
 			log.Printf("Warning: Failed to initialize Gemini provider: %v", err)
 		} else {
-			handler.provider = provider
+			handler.providers.Register(provider)
 			log.Printf("Gemini provider initialized (model: gemini-2.5-flash)")
 		}
 	}
 
-	// Fallback to OpenAI if no provider yet and key is available
-	if handler.provider == nil && cfg.OpenAI.APIKey != "" {
+	// OpenAI as fallback or alternative backend
+	if cfg.OpenAI.APIKey != "" {
 		provider, err := providers.NewOpenAIProvider(providers.OpenAIConfig{
 			APIKey:    cfg.OpenAI.APIKey,
 			Model:     cfg.OpenAI.Model,
 			MaxTokens: cfg.OpenAI.MaxTokens,
 			Timeout:   cfg.OpenAI.Timeout,
+			BaseURL:   cfg.OpenAI.BaseURL,
 		})
 		if err != nil {
 			log.Printf("Warning: Failed to initialize OpenAI provider: %v", err)
 		} else {
-			handler.provider = provider
+			handler.providers.Register(provider)
 			log.Printf("OpenAI provider initialized (model: %s)", cfg.OpenAI.Model)
 		}
 	}
 
+	// Restore the provider and model chosen in a previous run
+	state, err := daemon.LoadState(cfg.DataDir)
+	if err != nil {
+		log.Printf("Warning: Failed to load state: %v", err)
+		state = &daemon.State{}
+	}
+	handler.state = state
+
+	if p := handler.providers.Get(state.Provider); p != nil {
+		if ms, ok := p.(providers.ModelSelector); ok && state.Model != "" {
+			ms.SetModel(state.Model)
+		}
+		handler.provider = p
+		log.Printf("Restored provider: %s (model: %s)", p.Name(), providers.CurrentModel(p))
+	} else if names := handler.providers.Names(); len(names) > 0 {
+		handler.provider = handler.providers.Get(names[0])
+	}
+
 	if handler.provider == nil {
 		log.Printf("Warning: No AI provider available. Set GOOGLE_API_KEY or OPENAI_API_KEY")
 	}
 
 	// Initialize conversation manager
 	convMgr, err := conversation.NewManager(conversation.ManagerConfig{
-		DataDir: cfg.DataDir,
+		DataDir:       cfg.DataDir,
+		ContextLimits: cfg.ContextLimits,
 	}, handler.provider)
 	if err != nil {
 		log.Fatalf("Failed to initialize conversation manager: %v", err)
 	}
 	handler.convMgr = convMgr
+	handler.scheduler = conversation.NewScheduler(cfg.MaxConcurrent)
 	defer convMgr.Close()
 
 	// Create IPC server
@@ -130,27 +221,44 @@ func runDaemon() {
 	}
 	handler.ipcServer = ipcServer
 
-	// Set stream callback
-	convMgr.SetStreamCallback(func(convID, msgID, content string, done bool) {
+	// Set stream callback (chunks go to the requester and conversation subscribers)
+	convMgr.SetStreamCallback(func(ctx context.Context, convID, msgID, content string, done bool) {
 		msg, _ := ipc.NewMessage(ipc.TypeChatChunk, ipc.ChatChunkPayload{
 			ConversationID: convID,
 			MessageID:      msgID,
 			Content:        content,
 			Done:           done,
 		})
-		ipcServer.Broadcast(msg)
+		if requestID := ipc.RequestIDFromContext(ctx); requestID != "" {
+			msg.RequestID = requestID
+		}
+		ipcServer.Publish(ctx, convID, msg)
 	})
 
+	// Report client activity before the first (possibly socket-activating)
+	// client can connect
+	d.AttachIPC(ipcServer)
+
 	// Start IPC server
 	ipcServer.Start()
 	defer ipcServer.Stop()
 
-	// Create and run daemon
-	d, err := daemon.New(cfg)
-	if err != nil {
-		log.Fatalf("Failed to create daemon: %v", err)
+	// Start optional HTTP gateway (same handler as the socket)
+	if cfg.HTTP.Enabled {
+		gw, err := gateway.New(gateway.Config{
+			Addr:      cfg.HTTP.Addr,
+			TokenFile: cfg.HTTP.TokenFile,
+		}, ipcServer)
+		if err != nil {
+			log.Fatalf("Failed to create HTTP gateway: %v", err)
+		}
+		if err := gw.Start(); err != nil {
+			log.Fatalf("Failed to start HTTP gateway: %v", err)
+		}
+		defer gw.Stop()
 	}
 
+	// Run daemon
 	if err := d.Run(); err != nil {
 		log.Fatalf("Daemon error: %v", err)
 	}
@@ -159,22 +267,81 @@ func runDaemon() {
 // Handler implements ipc.MessageHandler
 type Handler struct {
 	cfg       *daemon.Config
+	daemon    *daemon.Daemon
 	provider  providers.Provider
 	convMgr   *conversation.Manager
 	ipcServer *ipc.Server
 	sanitizer *security.Sanitizer
+	requests  *daemon.RequestTracker
+	scheduler *conversation.Scheduler
+
+	// Runtime provider/model selection
+	providers  *providers.Registry
+	state      *daemon.State
+	providerMu sync.RWMutex
+}
+
+// activeProvider returns the provider currently used for chats
+func (h *Handler) activeProvider() providers.Provider {
+	h.providerMu.RLock()
+	defer h.providerMu.RUnlock()
+	return h.provider
+}
+
+// turnTypes are the requests that run in turn with a conversation's
+// replies: the chat turns, and branch switches, which a reply still
+// being stored would otherwise undo
+var turnTypes = map[string]bool{
+	ipc.TypeChat:         true,
+	ipc.TypeRetry:        true,
+	ipc.TypeEditMessage:  true,
+	ipc.TypeRegenerate:   true,
+	ipc.TypeSwitchBranch: true,
+}
+
+// turnKey is the context key for a turn reserved by Prepare
+type turnKey struct{}
+
+// Prepare reserves the conversation's turn for chat-style requests as
+// they are read, so turns run in arrival order however long the handler
+// takes to get to them
+func (h *Handler) Prepare(ctx context.Context, client *ipc.Client, msg *ipc.Message) context.Context {
+	if !turnTypes[msg.Type] {
+		return ctx
+	}
+
+	var payload struct {
+		ConversationID string `json:"conversation_id"`
+	}
+	if json.Unmarshal(msg.Payload, &payload) != nil || payload.ConversationID == "" {
+		return ctx // New conversations have nothing to wait for
+	}
+	return context.WithValue(ctx, turnKey{}, h.scheduler.Reserve(payload.ConversationID))
+}
+
+// reservedTurn returns the turn reserved by Prepare, if any
+func reservedTurn(ctx context.Context) *conversation.Turn {
+	t, _ := ctx.Value(turnKey{}).(*conversation.Turn)
+	return t
 }
 
 // HandleMessage processes incoming IPC messages
 func (h *Handler) HandleMessage(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
 	log.Printf("IPC message: %s (id: %s)", msg.Type, msg.RequestID)
 
+	// Requests rejected before their turn must still give it up
+	if t := reservedTurn(ctx); t != nil {
+		defer t.Release()
+	}
+
 	// Lazy init sanitizer
 	if h.sanitizer == nil {
 		h.sanitizer = security.NewSanitizer()
 	}
 
 	switch msg.Type {
+	case ipc.TypeHello:
+		return h.handleHello(ctx, client, msg)
 	case ipc.TypeChat:
 		return h.handleChat(ctx, client, msg)
 	case ipc.TypeNewConv:
@@ -185,14 +352,71 @@ func (h *Handler) HandleMessage(ctx context.Context, client *ipc.Client, msg *ip
 		return h.handleListConvs(ctx, client, msg)
 	case ipc.TypeDeleteConv:
 		return h.handleDeleteConv(ctx, client, msg)
+	case ipc.TypeUpdateConv:
+		return h.handleUpdateConv(ctx, client, msg)
+	case ipc.TypeSearchConvs:
+		return h.handleSearchConvs(ctx, client, msg)
 	case ipc.TypeStatus:
 		return h.handleStatus(ctx, client, msg)
+	case ipc.TypeCancel:
+		return h.handleCancel(ctx, client, msg)
+	case ipc.TypeRetry:
+		return h.handleRetry(ctx, client, msg)
+	case ipc.TypeEditMessage:
+		return h.handleEditMessage(ctx, client, msg)
+	case ipc.TypeRegenerate:
+		return h.handleRegenerate(ctx, client, msg)
+	case ipc.TypeSwitchBranch:
+		return h.handleSwitchBranch(ctx, client, msg)
+	case ipc.TypeSetProvider:
+		return h.handleSetProvider(ctx, client, msg)
+	case ipc.TypeSetModel:
+		return h.handleSetModel(ctx, client, msg)
 	default:
 		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq,
 			fmt.Sprintf("Unknown message type: %s", msg.Type), false)
 	}
 }
 
+func (h *Handler) handleHello(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	var payload ipc.HelloPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Invalid payload", false)
+	}
+
+	if !ipc.SupportsVersion(payload.ProtocolVersion) {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq,
+			fmt.Sprintf("Unsupported protocol version %d (daemon %s supports %d-%d)",
+				payload.ProtocolVersion, version, ipc.MinProtocolVersion, ipc.ProtocolVersion), false)
+	}
+
+	var caps providers.Capabilities
+	if p := h.activeProvider(); p != nil {
+		caps = providers.CapabilitiesOf(p)
+	}
+
+	resp, _ := msg.Response(ipc.TypeHello, ipc.HelloReplyPayload{
+		ProtocolVersion:    ipc.ProtocolVersion,
+		MinProtocolVersion: ipc.MinProtocolVersion,
+		DaemonVersion:      version,
+		MessageTypes:       requestTypes,
+		Features: ipc.Features{
+			Streaming:   caps.Streaming,
+			Attachments: caps.Attachments,
+			Images:      caps.Images,
+			Tools:       caps.Tools,
+		},
+		Limits: ipc.Limits{
+			MaxMessageBytes: ipc.MaxMessageSize,
+			MaxInputChars:   h.sanitizer.MaxInputLength(),
+			MaxAttachments:  conversation.MaxAttachments,
+			MaxAttachmentKB: conversation.MaxAttachmentText >> 10,
+		},
+	})
+	client.Send(resp)
+	return nil
+}
+
 func (h *Handler) handleChat(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
 	var payload ipc.ChatPayload
 	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
@@ -200,7 +424,7 @@ func (h *Handler) handleChat(ctx context.Context, client *ipc.Client, msg *ipc.M
 	}
 
 	// Check provider
-	if h.provider == nil {
+	if h.activeProvider() == nil {
 		return h.sendError(client, msg.RequestID, ipc.ErrCodeAuthFailed,
 			"No AI provider available. Check OPENAI_API_KEY.", false)
 	}
@@ -213,49 +437,304 @@ func (h *Handler) handleChat(ctx context.Context, client *ipc.Client, msg *ipc.M
 		}
 	}
 
-	// Create conversation if not specified
+	if len(payload.Attachments) > conversation.MaxAttachments {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq,
+			fmt.Sprintf("too many attachments (max %d)", conversation.MaxAttachments), false)
+	}
+
+	// A new conversation gets its ID now but is only stored once its turn
+	// runs, so a rejected or cancelled request leaves nothing behind
 	convID := payload.ConversationID
-	if convID == "" {
-		conv, err := h.convMgr.NewConversation("")
+	isNew := convID == ""
+	if isNew {
+		convID = conversation.NewConversationID()
+	}
+
+	return h.runTurn(ctx, client, msg, convID, func(ctx context.Context) (*conversation.ChatResult, error) {
+		// Read attached files (slow for PDFs) once it is our turn
+		attachments, err := h.readAttachments(ctx, payload.Attachments)
 		if err != nil {
-			return h.sendError(client, msg.RequestID, ipc.ErrCodeInternal, err.Error(), false)
+			return nil, &requestError{err}
+		}
+		if isNew {
+			if _, err := h.convMgr.NewConversationWithID(convID, ""); err != nil {
+				return nil, err
+			}
+		}
+		return h.convMgr.Chat(ctx, convID, result.Input, attachments...)
+	})
+}
+
+// readAttachments reads the files attached to a chat message,
+// sanitizing extracted text
+func (h *Handler) readAttachments(ctx context.Context, paths []string) ([]*conversation.Attachment, error) {
+	if len(paths) > conversation.MaxAttachments {
+		return nil, fmt.Errorf("too many attachments (max %d)", conversation.MaxAttachments)
+	}
+
+	attachments := make([]*conversation.Attachment, 0, len(paths))
+	for _, path := range paths {
+		att, err := conversation.ReadAttachment(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if att.IsImage() {
+			if !providers.CapabilitiesOf(h.activeProvider()).Images {
+				return nil, fmt.Errorf("attachment %q: provider does not accept images", att.Name)
+			}
+			attachments = append(attachments, att)
+			continue
+		}
+
+		// Sized by MaxAttachmentText; the prompt length cap does not apply
+		result := h.sanitizer.Clean(att.Content)
+		for _, w := range result.Warnings {
+			log.Printf("Sanitization warning (%s): %s - %s", att.Name, w.Type, w.Message)
 		}
-		convID = conv.ID
+		att.Content = result.Input
+
+		attachments = append(attachments, att)
+	}
+	return attachments, nil
+}
+
+// runTurn acknowledges a chat-style request, waits for the
+// conversation's turn and runs fn, which streams the reply. The stored
+// reply is announced with chat_complete; failures become error replies.
+func (h *Handler) runTurn(ctx context.Context, client *ipc.Client, msg *ipc.Message, convID string,
+	fn func(ctx context.Context) (*conversation.ChatResult, error)) error {
+	// Track the request so it can be cancelled
+	ctx, done, err := h.requests.Track(ctx, msg.RequestID, convID)
+	if err != nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, err.Error(), false)
 	}
+	defer done()
 
 	// Send acknowledgment
 	ack, _ := msg.Response(ipc.TypeAck, map[string]string{"conversation_id": convID})
 	client.Send(ack)
 
-	// Process chat (streaming handled by callback)
-	_, err := h.convMgr.Chat(ctx, convID, result.Input)
+	// Wait for earlier turns of this conversation
+	turn := reservedTurn(ctx)
+	if turn == nil || turn.ConversationID() != convID {
+		turn = h.scheduler.Reserve(convID)
+	}
+	defer turn.Release()
+
+	if err := h.waitTurn(ctx, client, msg, turn); err != nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeCancelled, "Request cancelled", false)
+	}
+
+	result, err := fn(ctx)
 	if err != nil {
-		// Determine error type
-		code := ipc.ErrCodeInternal
-		retryable := false
-
-		if pe, ok := err.(*providers.ProviderError); ok {
-			switch pe.Code {
-			case providers.ErrCodeRateLimit:
-				code = ipc.ErrCodeRateLimit
-				retryable = true
-			case providers.ErrCodeAuth:
-				code = ipc.ErrCodeAuthFailed
-			case providers.ErrCodeNetwork:
-				code = ipc.ErrCodeNetworkErr
-				retryable = true
-			case providers.ErrCodeServer:
-				code = ipc.ErrCodeServerDown
-				retryable = true
-			case providers.ErrCodeContextLen:
-				code = ipc.ErrCodeTokenLimit
-			}
+		var reqErr *requestError
+		if errors.As(err, &reqErr) ||
+			errors.Is(err, conversation.ErrNothingToRetry) ||
+			errors.Is(err, conversation.ErrNotEditable) ||
+			errors.Is(err, conversation.ErrNothingToRegenerate) {
+			return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, err.Error(), false)
+		}
+		code, retryable := chatErrorCode(err)
+		if code == ipc.ErrCodeCancelled {
+			return h.sendError(client, msg.RequestID, code, "Request cancelled", false)
 		}
-
 		return h.sendError(client, msg.RequestID, code, err.Error(), retryable)
 	}
 
-	// Complete message sent via stream callback
+	h.sendComplete(ctx, msg, result)
+	return nil
+}
+
+// requestError marks a turn failure caused by the request itself
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string { return e.err.Error() }
+func (e *requestError) Unwrap() error { return e.err }
+
+// waitTurn waits behind running turns of the same conversation and the
+// global concurrency limit, telling the client its position
+func (h *Handler) waitTurn(ctx context.Context, client *ipc.Client, msg *ipc.Message, turn *conversation.Turn) error {
+	return turn.Wait(ctx, func(st conversation.QueueStatus) {
+		resp, _ := msg.Response(ipc.TypeQueued, ipc.QueuedPayload{
+			ConversationID: turn.ConversationID(),
+			Position:       st.Position,
+			Reason:         st.Reason,
+		})
+		client.Send(resp)
+	})
+}
+
+// sendComplete sends the final chat_complete message for a stored reply
+func (h *Handler) sendComplete(ctx context.Context, msg *ipc.Message, result *conversation.ChatResult) {
+	hash := sha256.Sum256([]byte(result.Message.Content))
+
+	resp, _ := msg.Response(ipc.TypeChatComplete, ipc.ChatCompletePayload{
+		ConversationID: result.Message.ConversationID,
+		MessageID:      result.Message.ID,
+		ContentHash:    hex.EncodeToString(hash[:]),
+		ContentLength:  len(result.Message.Content),
+		FinishReason:   result.FinishReason,
+		Model:          result.Model,
+		Provider:       result.Provider,
+		Usage: ipc.TokenUsage{
+			Prompt:     result.Usage.Prompt,
+			Completion: result.Usage.Completion,
+			Total:      result.Usage.Total,
+		},
+		LatencyMs: result.Latency.Milliseconds(),
+		Version:   result.Message.SiblingIndex,
+		Versions:  result.Message.SiblingCount,
+	})
+	h.ipcServer.Publish(ctx, result.Message.ConversationID, resp)
+}
+
+func (h *Handler) handleRetry(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	var payload ipc.RetryPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.ConversationID == "" {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Invalid payload", false)
+	}
+
+	// Check provider
+	if h.activeProvider() == nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeAuthFailed,
+			"No AI provider available. Check OPENAI_API_KEY.", false)
+	}
+
+	// Regenerate the failed reply
+	return h.runTurn(ctx, client, msg, payload.ConversationID, func(ctx context.Context) (*conversation.ChatResult, error) {
+		return h.convMgr.Retry(ctx, payload.ConversationID)
+	})
+}
+
+func (h *Handler) handleEditMessage(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	var payload ipc.EditMessagePayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.ConversationID == "" || payload.MessageID == "" {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Invalid payload", false)
+	}
+
+	// Check provider
+	if h.activeProvider() == nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeAuthFailed,
+			"No AI provider available. Check OPENAI_API_KEY.", false)
+	}
+
+	// Sanitize input
+	result := h.sanitizer.Sanitize(payload.Content)
+	for _, w := range result.Warnings {
+		log.Printf("Sanitization warning: %s - %s", w.Type, w.Message)
+	}
+	if strings.TrimSpace(result.Input) == "" {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Content must not be empty", false)
+	}
+
+	// Branch off and answer the edit
+	return h.runTurn(ctx, client, msg, payload.ConversationID, func(ctx context.Context) (*conversation.ChatResult, error) {
+		return h.convMgr.EditMessage(ctx, payload.ConversationID, payload.MessageID, result.Input)
+	})
+}
+
+func (h *Handler) handleRegenerate(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	var payload ipc.RegeneratePayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.ConversationID == "" {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Invalid payload", false)
+	}
+
+	// Check provider
+	if h.activeProvider() == nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeAuthFailed,
+			"No AI provider available. Check OPENAI_API_KEY.", false)
+	}
+
+	// Ask again
+	return h.runTurn(ctx, client, msg, payload.ConversationID, func(ctx context.Context) (*conversation.ChatResult, error) {
+		return h.convMgr.Regenerate(ctx, payload.ConversationID, payload.MessageID)
+	})
+}
+
+func (h *Handler) handleSwitchBranch(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	var payload ipc.SwitchBranchPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.ConversationID == "" || payload.MessageID == "" {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Invalid payload", false)
+	}
+
+	// Wait for running replies to be stored; switching needs no provider
+	// slot. No queued notices: callers expect a single reply.
+	if turn := reservedTurn(ctx); turn != nil {
+		if err := turn.WaitInOrder(ctx, nil); err != nil {
+			return h.sendError(client, msg.RequestID, ipc.ErrCodeCancelled, "Request cancelled", false)
+		}
+	}
+
+	conv, messages, err := h.convMgr.SwitchBranch(payload.ConversationID, payload.MessageID, payload.Version)
+	if err != nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, err.Error(), false)
+	}
+
+	resp, _ := msg.Response(ipc.TypeConvData, map[string]interface{}{
+		"conversation": conv,
+		"messages":     messages,
+	})
+	client.Send(resp)
+	return nil
+}
+
+// chatErrorCode maps a chat error to an IPC error code
+func chatErrorCode(err error) (code string, retryable bool) {
+	if errors.Is(err, context.Canceled) {
+		return ipc.ErrCodeCancelled, false
+	}
+
+	var pe *providers.ProviderError
+	if !errors.As(err, &pe) {
+		return ipc.ErrCodeInternal, false
+	}
+
+	switch pe.Code {
+	case providers.ErrCodeRateLimit:
+		return ipc.ErrCodeRateLimit, true
+	case providers.ErrCodeAuth:
+		return ipc.ErrCodeAuthFailed, false
+	case providers.ErrCodeNetwork, providers.ErrCodeTimeout:
+		return ipc.ErrCodeNetworkErr, true
+	case providers.ErrCodeServer:
+		return ipc.ErrCodeServerDown, true
+	case providers.ErrCodeContextLen:
+		return ipc.ErrCodeTokenLimit, false
+	case providers.ErrCodeCancelled:
+		return ipc.ErrCodeCancelled, false
+	}
+	return ipc.ErrCodeInternal, false
+}
+
+func (h *Handler) handleCancel(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	var payload ipc.CancelPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Invalid payload", false)
+	}
+
+	cancelled := 0
+	switch {
+	case payload.RequestID != "":
+		if h.requests.CancelRequest(payload.RequestID) {
+			cancelled = 1
+		}
+	case payload.ConversationID != "":
+		cancelled = h.requests.CancelConversation(payload.ConversationID)
+	default:
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq,
+			"request_id or conversation_id is required", false)
+	}
+
+	if cancelled == 0 {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "No in-flight request to cancel", false)
+	}
+
+	log.Printf("Cancelled %d request(s)", cancelled)
+	resp, _ := msg.Response(ipc.TypeAck, map[string]int{"cancelled": cancelled})
+	client.Send(resp)
 	return nil
 }
 
@@ -295,7 +774,25 @@ func (h *Handler) handleLoadConv(ctx context.Context, client *ipc.Client, msg *i
 }
 
 func (h *Handler) handleListConvs(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
-	convs, err := h.convMgr.ListConversations(50)
+	var payload ipc.ListConvsPayload
+	if len(msg.Payload) > 0 {
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Invalid payload", false)
+		}
+	}
+
+	filter, err := conversation.ParseArchiveFilter(payload.Archived)
+	if err != nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, err.Error(), false)
+	}
+
+	limit := payload.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	limit = min(limit, maxListLimit)
+
+	convs, err := h.convMgr.ListConversations(limit, filter)
 	if err != nil {
 		return h.sendError(client, msg.RequestID, ipc.ErrCodeInternal, err.Error(), false)
 	}
@@ -320,25 +817,202 @@ func (h *Handler) handleDeleteConv(ctx context.Context, client *ipc.Client, msg
 	return nil
 }
 
+func (h *Handler) handleUpdateConv(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	var payload ipc.UpdateConvPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.ID == "" {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Invalid payload", false)
+	}
+
+	if payload.Title != nil {
+		title := strings.TrimSpace(h.sanitizer.Sanitize(*payload.Title).Input)
+		if title == "" {
+			return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Title must not be empty", false)
+		}
+		payload.Title = &title
+	}
+
+	conv, err := h.convMgr.UpdateConversation(payload.ID, conversation.ConversationUpdate{
+		Title:    payload.Title,
+		Archived: payload.Archived,
+		Pinned:   payload.Pinned,
+	})
+	if err != nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInternal, err.Error(), false)
+	}
+
+	resp, _ := msg.Response(ipc.TypeConvData, conv)
+	client.Send(resp)
+	return nil
+}
+
+func (h *Handler) handleSearchConvs(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	var payload ipc.SearchConvsPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || strings.TrimSpace(payload.Query) == "" {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "query is required", false)
+	}
+
+	results, err := h.convMgr.Search(payload.Query, payload.Limit, payload.IncludeArchived)
+	if err != nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInternal, err.Error(), false)
+	}
+	if results == nil {
+		results = []*conversation.SearchResult{}
+	}
+
+	resp, _ := msg.Response(ipc.TypeSearchResult, map[string]interface{}{
+		"query":     payload.Query,
+		"results":   results,
+		"full_text": h.convMgr.FullTextSearch(),
+	})
+	client.Send(resp)
+	return nil
+}
+
 func (h *Handler) handleStatus(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	resp, _ := msg.Response(ipc.TypeStatus, h.status())
+	client.Send(resp)
+	return nil
+}
+
+// status builds the current status payload
+func (h *Handler) status() ipc.StatusPayload {
 	convCount, _ := h.convMgr.CountConversations()
 
 	providerName := "none"
 	model := ""
-	if h.provider != nil {
-		providerName = h.provider.Name()
-		if op, ok := h.provider.(*providers.OpenAIProvider); ok {
-			model = op.GetModel()
+	if p := h.activeProvider(); p != nil {
+		providerName = p.Name()
+		model = providers.CurrentModel(p)
+	}
+
+	ds := h.daemon.GetStatus()
+
+	status := ipc.StatusPayload{
+		Running:        true,
+		Version:        version,
+		Provider:       providerName,
+		Model:          model,
+		Providers:      h.providers.Names(),
+		Conversations:  convCount,
+		IdleSeconds:    int(ds.IdleRemaining.Seconds()),
+		UptimeSeconds:  int(ds.Uptime.Seconds()),
+		IdleForSeconds: int(ds.IdleTime.Seconds()),
+		Circuit:        h.convMgr.CircuitState(),
+		InFlight:       ds.InFlight,
+		Clients:        h.ipcServer.ClientCount(),
+		DBSizeBytes:    h.convMgr.DiskSize(),
+	}
+
+	if failure := h.convMgr.LastFailure(); failure != nil {
+		status.LastError = &ipc.LastErrorInfo{
+			Provider: failure.Provider,
+			Code:     failure.Code,
+			Message:  failure.Message,
+			At:       failure.At.UnixMilli(),
 		}
 	}
+	return status
+}
 
-	resp, _ := msg.Response(ipc.TypeStatus, ipc.StatusPayload{
-		Running:       true,
-		Provider:      providerName,
-		Model:         model,
-		Conversations: convCount,
-	})
+func (h *Handler) handleSetProvider(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	var payload ipc.SetProviderPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.Provider == "" {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Invalid payload", false)
+	}
+
+	p := h.providers.Get(payload.Provider)
+	if p == nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq,
+			fmt.Sprintf("Unknown provider: %s (available: %s)", payload.Provider, strings.Join(h.providers.Names(), ", ")), false)
+	}
+
+	if payload.Model != "" {
+		if err := h.applyModel(ctx, p, payload.Model); err != nil {
+			code, retryable := modelErrorCode(err)
+			return h.sendError(client, msg.RequestID, code, err.Error(), retryable)
+		}
+	}
+
+	h.providerMu.Lock()
+	h.provider = p
+	h.providerMu.Unlock()
+	h.convMgr.SetProvider(p)
+
+	log.Printf("Provider switched to %s (model: %s)", p.Name(), providers.CurrentModel(p))
+	return h.selectionChanged(client, msg)
+}
+
+func (h *Handler) handleSetModel(ctx context.Context, client *ipc.Client, msg *ipc.Message) error {
+	var payload ipc.SetModelPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.Model == "" {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeInvalidReq, "Invalid payload", false)
+	}
+
+	p := h.activeProvider()
+	if p == nil {
+		return h.sendError(client, msg.RequestID, ipc.ErrCodeAuthFailed,
+			"No AI provider available. Check OPENAI_API_KEY.", false)
+	}
+
+	if err := h.applyModel(ctx, p, payload.Model); err != nil {
+		code, retryable := modelErrorCode(err)
+		return h.sendError(client, msg.RequestID, code, err.Error(), retryable)
+	}
+
+	log.Printf("Model switched to %s (provider: %s)", payload.Model, p.Name())
+	return h.selectionChanged(client, msg)
+}
+
+// applyModel validates a model against the provider and makes it active
+func (h *Handler) applyModel(ctx context.Context, p providers.Provider, model string) error {
+	ms, ok := p.(providers.ModelSelector)
+	if !ok {
+		return fmt.Errorf("provider %s does not support model selection", p.Name())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := providers.ValidateModel(ctx, p, model); err != nil {
+		return err
+	}
+
+	ms.SetModel(model)
+	return nil
+}
+
+// modelErrorCode maps a model selection error to an IPC error code
+func modelErrorCode(err error) (code string, retryable bool) {
+	var pe *providers.ProviderError
+	if !errors.As(err, &pe) {
+		return ipc.ErrCodeInvalidReq, false
+	}
+	if pe.Code == providers.ErrCodeModelNotAvailable {
+		return ipc.ErrCodeInvalidReq, false
+	}
+	return chatErrorCode(err)
+}
+
+// selectionChanged persists the provider/model choice and notifies all clients
+func (h *Handler) selectionChanged(client *ipc.Client, msg *ipc.Message) error {
+	p := h.activeProvider()
+
+	h.providerMu.Lock()
+	h.state.Provider = p.Name()
+	h.state.Model = providers.CurrentModel(p)
+	err := h.state.Save(h.cfg.DataDir)
+	h.providerMu.Unlock()
+	if err != nil {
+		log.Printf("Warning: Failed to save state: %v", err)
+	}
+
+	status := h.status()
+
+	resp, _ := msg.Response(ipc.TypeStatus, status)
 	client.Send(resp)
+
+	update, _ := ipc.NewMessage(ipc.TypeStatus, status)
+	h.ipcServer.BroadcastExcept(update, client)
 	return nil
 }
 
@@ -353,46 +1027,81 @@ func (h *Handler) sendError(client *ipc.Client, requestID, code, message string,
 	return nil
 }
 
-func checkStatus() {
-	cfg := daemon.DefaultConfig()
+func checkStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Output JSON (for status bars)")
+	fs.Parse(args)
 
-	conn, err := net.DialTimeout("unix", cfg.SocketPath, 2*time.Second)
+	status, err := fetchStatus()
 	if err != nil {
-		fmt.Println("❌ Daemon is not running")
+		if *asJSON {
+			printJSON(ipc.StatusPayload{Running: false})
+		} else {
+			fmt.Printf("❌ Daemon is not running (%v)\n", err)
+		}
 		os.Exit(1)
 	}
-	defer conn.Close()
 
-	// Send status request
-	msg, _ := ipc.NewMessage(ipc.TypeStatus, nil)
-	data, _ := json.Marshal(msg)
-	data = append(data, '\n')
-	conn.Write(data)
+	if *asJSON {
+		printJSON(status)
+		return
+	}
 
-	// Set read timeout
-	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	fmt.Printf("✅ Daemon is running (version %s)\n", status.Version)
+	fmt.Printf("   Provider: %s (%s)", status.Provider, status.Model)
+	if len(status.Providers) > 1 {
+		fmt.Printf("  [available: %s]", strings.Join(status.Providers, ", "))
+	}
+	fmt.Println()
+	fmt.Printf("   Uptime: %s\n", seconds(status.UptimeSeconds))
+	fmt.Printf("   Idle: %s (shutdown in %s)\n", seconds(status.IdleForSeconds), seconds(status.IdleSeconds))
+	fmt.Printf("   Circuit breaker: %s\n", status.Circuit)
+	fmt.Printf("   Requests in flight: %d\n", status.InFlight)
+	fmt.Printf("   Connected clients: %d\n", status.Clients)
+	fmt.Printf("   Conversations: %d (%s on disk)\n", status.Conversations, byteSize(status.DBSizeBytes))
+	if e := status.LastError; e != nil {
+		fmt.Printf("   Last error: %s %s %s\n", time.UnixMilli(e.At).Local().Format(time.DateTime), e.Provider, e.Message)
+	}
+}
 
-	// Read response
-	buf := make([]byte, 4096)
-	n, err := conn.Read(buf)
+// fetchStatus asks the running daemon for its status
+func fetchStatus() (*ipc.StatusPayload, error) {
+	conn, err := connectDaemon()
 	if err != nil {
-		fmt.Println("❌ Failed to read response")
-		os.Exit(1)
+		return nil, err
 	}
+	defer conn.Close()
 
-	var resp ipc.Message
-	if err := json.Unmarshal(buf[:n], &resp); err != nil {
-		fmt.Println("❌ Invalid response")
-		os.Exit(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reply, err := conn.Call(ctx, ipc.TypeStatus, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	var status ipc.StatusPayload
-	json.Unmarshal(resp.Payload, &status)
+	if err := json.Unmarshal(reply.Payload, &status); err != nil {
+		return nil, fmt.Errorf("invalid status: %w", err)
+	}
+	return &status, nil
+}
 
-	fmt.Println("✅ Daemon is running")
-	fmt.Printf("   Provider: %s\n", status.Provider)
-	fmt.Printf("   Model: %s\n", status.Model)
-	fmt.Printf("   Conversations: %d\n", status.Conversations)
+// seconds formats a duration given in seconds
+func seconds(n int) string {
+	return (time.Duration(n) * time.Second).String()
+}
+
+// byteSize formats a byte count
+func byteSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
 }
 
 func runTest() {
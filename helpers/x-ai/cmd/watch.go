@@ -0,0 +1,166 @@
+// x-ai watch - live view of IPC traffic for debugging the UI
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"x-ai/internal/ipc"
+)
+
+// maxWatchPayload is how much of a payload is shown without -full
+const maxWatchPayload = 160
+
+// keepAliveTypes are hidden unless asked for with -all or -type
+var keepAliveTypes = map[string]bool{
+	ipc.TypeHeartbeat: true,
+	ipc.TypePing:      true,
+	ipc.TypePong:      true,
+}
+
+// watchFilter selects which mirrored messages are printed
+type watchFilter struct {
+	types  map[string]bool
+	convID string
+	all    bool
+}
+
+// runWatch prints every message between the daemon and its clients
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	types := fs.String("type", "", "Only show these message `types` (comma separated)")
+	convID := fs.String("c", "", "Only show messages of conversation `id` (prefix)")
+	redact := fs.Bool("redact", false, "Hide message content, titles and other user text")
+	all := fs.Bool("all", false, "Include heartbeats and pings")
+	full := fs.Bool("full", false, "Print complete payloads")
+	asJSON := fs.Bool("json", false, "Print raw events as JSON lines")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: x-ai watch [-type t1,t2] [-c id] [-redact] [-all] [-full] [-json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	filter := &watchFilter{convID: *convID, all: *all}
+	if *types != "" {
+		filter.types = make(map[string]bool)
+		for _, t := range strings.Split(*types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.types[t] = true
+			}
+		}
+	}
+
+	conn, err := connectDaemon()
+	if err != nil {
+		fail(err)
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if _, err := conn.Call(ctx, ipc.TypeMonitor, ipc.MonitorPayload{Redact: *redact}); err != nil {
+		fail(fmt.Errorf("monitor: %w", err))
+	}
+	fmt.Fprintln(os.Stderr, "👀 Watching IPC traffic (Ctrl-C to stop)")
+
+	for {
+		msg, err := conn.Next(ctx)
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		if err != nil {
+			fail(err)
+		}
+		if msg.Type != ipc.TypeMonitorEvent {
+			continue
+		}
+
+		var event ipc.MonitorEventPayload
+		if err := json.Unmarshal(msg.Payload, &event); err != nil || event.Message == nil {
+			continue
+		}
+		if !filter.match(event.Message) {
+			continue
+		}
+
+		if *asJSON {
+			data, _ := json.Marshal(event)
+			fmt.Println(string(data))
+			continue
+		}
+		printEvent(time.UnixMilli(msg.Timestamp), &event, *full)
+	}
+}
+
+// match reports whether a message passes the filter
+func (f *watchFilter) match(msg *ipc.Message) bool {
+	if f.types != nil {
+		if !f.types[msg.Type] {
+			return false
+		}
+	} else if !f.all && keepAliveTypes[msg.Type] {
+		return false
+	}
+
+	if f.convID != "" {
+		return strings.HasPrefix(messageConvID(msg), f.convID)
+	}
+	return true
+}
+
+// messageConvID extracts the conversation a message refers to, if any
+func messageConvID(msg *ipc.Message) string {
+	var payload struct {
+		ConversationID string `json:"conversation_id"`
+		ID             string `json:"id"`
+		Conversation   struct {
+			ID string `json:"id"`
+		} `json:"conversation"`
+	}
+	if json.Unmarshal(msg.Payload, &payload) != nil {
+		return ""
+	}
+
+	switch {
+	case payload.ConversationID != "":
+		return payload.ConversationID
+	case payload.Conversation.ID != "":
+		return payload.Conversation.ID
+	case strings.Contains(msg.Type, "conv"):
+		return payload.ID
+	}
+	return ""
+}
+
+// printEvent prints one mirrored message on a single line.
+// at is when the daemon saw it (client timestamps can't be trusted).
+func printEvent(at time.Time, event *ipc.MonitorEventPayload, full bool) {
+	msg := event.Message
+
+	arrow := "→" // Client → daemon
+	if event.Direction == ipc.DirectionOut {
+		arrow = "←"
+	}
+
+	client := shortID(event.ClientID)
+	if event.Local {
+		client += " (http)"
+	}
+
+	payload := string(msg.Payload)
+	if !full && len([]rune(payload)) > maxWatchPayload {
+		payload = string([]rune(payload)[:maxWatchPayload]) + "…"
+	}
+
+	fmt.Printf("%s %s %-8s %-14s req=%s %s\n",
+		at.Format("15:04:05.000"),
+		arrow, client, msg.Type, shortID(msg.RequestID), payload)
+}
@@ -0,0 +1,244 @@
+// Package conversation - file attachments
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"x-ai/internal/providers"
+)
+
+// Attachment limits
+const (
+	MaxAttachments    = 10      // Per message
+	MaxAttachmentText = 1 << 20 // Text kept per attachment (file or PDF text layer), 1 MB
+
+	maxTextFileSize  = MaxAttachmentText
+	maxPDFFileSize   = 32 << 20 // 32 MB (only the extracted text is kept)
+	maxImageFileSize = 10 << 20 // 10 MB (stored as-is)
+	pdfTimeout       = 30 * time.Second
+)
+
+// Attachment is a file attached to a user message
+type Attachment struct {
+	ID        string    `json:"id"`
+	MessageID string    `json:"message_id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"` // Original file size in bytes
+	Content   string    `json:"-"`    // Extracted text sent to the provider
+	Data      []byte    `json:"-"`    // Image bytes
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsImage reports whether the attachment is an image
+func (a *Attachment) IsImage() bool {
+	return strings.HasPrefix(a.MimeType, "image/")
+}
+
+// imageTypes maps supported image extensions to MIME types
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".webp": "image/webp",
+	".gif":  "image/gif",
+}
+
+// textTypes maps known text file extensions to MIME types
+var textTypes = map[string]string{
+	".txt":  "text/plain",
+	".log":  "text/plain",
+	".csv":  "text/csv",
+	".md":   "text/markdown",
+	".rst":  "text/x-rst",
+	".json": "application/json",
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".toml": "application/toml",
+	".xml":  "application/xml",
+	".html": "text/html",
+	".css":  "text/css",
+	".go":   "text/x-go",
+	".py":   "text/x-python",
+	".js":   "text/javascript",
+	".ts":   "text/x-typescript",
+	".qml":  "text/x-qml",
+	".c":    "text/x-c",
+	".h":    "text/x-c",
+	".cpp":  "text/x-c++",
+	".hpp":  "text/x-c++",
+	".rs":   "text/x-rust",
+	".java": "text/x-java",
+	".sh":   "text/x-shellscript",
+	".lua":  "text/x-lua",
+	".sql":  "application/sql",
+}
+
+// ReadAttachment reads a local file into an attachment. Text and source
+// files are read as-is; PDFs are converted with pdftotext; images are
+// kept as raw bytes.
+func ReadAttachment(ctx context.Context, path string) (*Attachment, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("attachment %q: path must be absolute", path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("attachment: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("attachment %q: not a regular file", path)
+	}
+
+	att := &Attachment{
+		Name: filepath.Base(path),
+		Path: path,
+		Size: info.Size(),
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".pdf" {
+		if info.Size() > maxPDFFileSize {
+			return nil, fmt.Errorf("attachment %q: exceeds %d MB", att.Name, maxPDFFileSize>>20)
+		}
+		att.MimeType = "application/pdf"
+		att.Content, err = extractPDF(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %q: %w", att.Name, err)
+		}
+		return att, nil
+	}
+
+	if mimeType, ok := imageTypes[ext]; ok {
+		if info.Size() > maxImageFileSize {
+			return nil, fmt.Errorf("attachment %q: exceeds %d MB", att.Name, maxImageFileSize>>20)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("attachment: %w", err)
+		}
+		if http.DetectContentType(data) != mimeType {
+			return nil, fmt.Errorf("attachment %q: not a valid %s image", att.Name, mimeType)
+		}
+		att.MimeType = mimeType
+		att.Data = data
+		return att, nil
+	}
+
+	if info.Size() > maxTextFileSize {
+		return nil, fmt.Errorf("attachment %q: exceeds %d KB", att.Name, maxTextFileSize>>10)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("attachment: %w", err)
+	}
+
+	att.MimeType = textTypes[ext]
+	if att.MimeType == "" {
+		// Unknown extension - accept anything that sniffs as text
+		if !strings.HasPrefix(http.DetectContentType(data), "text/") {
+			return nil, fmt.Errorf("attachment %q: unsupported file type", att.Name)
+		}
+		att.MimeType = "text/plain"
+	}
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("attachment %q: not UTF-8 text", att.Name)
+	}
+
+	att.Content = string(data)
+	return att, nil
+}
+
+// extractPDF returns the text layer of a PDF
+func extractPDF(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, pdfTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "pdftotext", "-layout", "-enc", "UTF-8", path, "-")
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", errors.New("pdftotext not found (install poppler)")
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("pdftotext: %s", msg)
+		}
+		return "", fmt.Errorf("pdftotext: %w", err)
+	}
+
+	text := strings.TrimSpace(string(out))
+	if text == "" {
+		return "", errors.New("no extractable text (scanned PDF?)")
+	}
+	if len(text) > MaxAttachmentText {
+		return "", fmt.Errorf("extracted text exceeds %d KB", MaxAttachmentText>>10)
+	}
+	return text, nil
+}
+
+// delimiterEscaper keeps attachment content from faking the delimiters
+// of its own or another attachment's block
+var delimiterEscaper = strings.NewReplacer(
+	"----- BEGIN ATTACHMENT", `\----- BEGIN ATTACHMENT`,
+	"----- END ATTACHMENT", `\----- END ATTACHMENT`,
+)
+
+// promptContent returns a message's content with its text attachments
+// appended as delimited blocks, as sent to the provider
+func promptContent(msg *Message) string {
+	if len(msg.Attachments) == 0 {
+		return msg.Content
+	}
+
+	var b strings.Builder
+	b.WriteString(msg.Content)
+	for _, att := range msg.Attachments {
+		if att.IsImage() {
+			continue
+		}
+		name := strings.Join(strings.Fields(att.Name), " ") // File names may contain newlines
+		fmt.Fprintf(&b, "\n\n----- BEGIN ATTACHMENT: %s (%s) -----\n", name, att.MimeType)
+		b.WriteString(delimiterEscaper.Replace(strings.TrimRight(att.Content, "\n")))
+		fmt.Fprintf(&b, "\n----- END ATTACHMENT: %s -----", name)
+	}
+	return b.String()
+}
+
+// providerMessage converts a stored message for the provider. Image
+// attachments become image parts following the text.
+func providerMessage(msg *Message) providers.Message {
+	pm := providers.Message{
+		Role:    msg.Role,
+		Content: promptContent(msg),
+	}
+
+	for _, att := range msg.Attachments {
+		if !att.IsImage() {
+			continue
+		}
+		if len(pm.Parts) == 0 {
+			pm.Parts = append(pm.Parts, providers.Part{Type: providers.PartText, Text: pm.Content})
+		}
+		pm.Parts = append(pm.Parts, providers.Part{
+			Type:     providers.PartImage,
+			Data:     att.Data,
+			MimeType: att.MimeType,
+		})
+	}
+	return pm
+}
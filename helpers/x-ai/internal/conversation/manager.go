@@ -3,9 +3,12 @@ package conversation
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -31,16 +34,59 @@ type Manager struct {
 	// System prompt for all conversations
 	systemPrompt string
 
+	// Context window overrides (see ManagerConfig)
+	contextLimits map[string]int
+
 	// Callbacks
-	onStreamChunk func(conversationID, messageID, content string, done bool)
+	onStreamChunk StreamCallback
+
+	// Most recent provider failure, for status reporting
+	lastErr   *ProviderFailure
+	lastErrMu sync.Mutex
+}
+
+// ProviderFailure records a failed provider call
+type ProviderFailure struct {
+	Provider string
+	Code     string
+	Message  string
+	At       time.Time
+}
+
+// ChatResult describes a completed assistant reply
+type ChatResult struct {
+	Message      *Message
+	Provider     string
+	Model        string
+	FinishReason string
+	Usage        providers.TokenUsage
+	Latency      time.Duration
 }
 
 // ManagerConfig holds manager configuration
 type ManagerConfig struct {
 	DataDir      string
 	SystemPrompt string
+
+	// Context window overrides by model name, in tokens
+	ContextLimits map[string]int
 }
 
+// ErrNothingToRetry is returned when the last turn did not fail
+var ErrNothingToRetry = errors.New("nothing to retry: last reply is complete")
+
+// ErrNotEditable is returned when editing anything but a user message
+var ErrNotEditable = errors.New("only user messages can be edited")
+
+// ErrNothingToRegenerate is returned when there is no reply to redo
+var ErrNothingToRegenerate = errors.New("nothing to regenerate: no assistant reply")
+
+// Markers appended to partial assistant replies
+const (
+	IncompleteMarker = "[incomplete]" // Provider failed mid-stream
+	CancelledMarker  = "[cancelled]"  // Client cancelled the request
+)
+
 // DefaultSystemPrompt is the base system prompt
 const DefaultSystemPrompt = `You are a helpful AI assistant.
 
@@ -74,10 +120,11 @@ func NewManager(cfg ManagerConfig, provider providers.Provider) (*Manager, error
 	executor := resilience.NewResilientExecutor(retryCfg, circuit)
 
 	return &Manager{
-		store:        store,
-		provider:     provider,
-		executor:     executor,
-		systemPrompt: systemPrompt,
+		store:         store,
+		provider:      provider,
+		executor:      executor,
+		systemPrompt:  systemPrompt,
+		contextLimits: cfg.ContextLimits,
 	}, nil
 }
 
@@ -93,13 +140,35 @@ func (m *Manager) SetProvider(provider providers.Provider) {
 	m.activeMu.Unlock()
 }
 
+// currentProvider returns the active provider
+func (m *Manager) currentProvider() providers.Provider {
+	m.activeMu.RLock()
+	defer m.activeMu.RUnlock()
+	return m.provider
+}
+
+// StreamCallback receives streaming chunks. ctx is the context of the
+// request that produced the chunk.
+type StreamCallback func(ctx context.Context, conversationID, messageID, content string, done bool)
+
 // SetStreamCallback sets the callback for streaming chunks
-func (m *Manager) SetStreamCallback(fn func(conversationID, messageID, content string, done bool)) {
+func (m *Manager) SetStreamCallback(fn StreamCallback) {
 	m.onStreamChunk = fn
 }
 
+// NewConversationID returns an ID for a conversation created later with
+// NewConversationWithID
+func NewConversationID() string {
+	return generateUUID()
+}
+
 // NewConversation creates a new conversation
 func (m *Manager) NewConversation(title string) (*Conversation, error) {
+	return m.NewConversationWithID(NewConversationID(), title)
+}
+
+// NewConversationWithID creates a new conversation with a pre-generated ID
+func (m *Manager) NewConversationWithID(id, title string) (*Conversation, error) {
 	m.activeMu.Lock()
 	defer m.activeMu.Unlock()
 
@@ -118,7 +187,7 @@ func (m *Manager) NewConversation(title string) (*Conversation, error) {
 		title = "New Chat"
 	}
 
-	conv, err := m.store.CreateConversation(providerName, model, title)
+	conv, err := m.store.CreateConversationWithID(id, providerName, model, title)
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +198,8 @@ func (m *Manager) NewConversation(title string) (*Conversation, error) {
 	return conv, nil
 }
 
-// LoadConversation loads a conversation by ID
+// LoadConversation loads a conversation by ID with the messages of its
+// active branch
 func (m *Manager) LoadConversation(id string) (*Conversation, []*Message, error) {
 	conv, err := m.store.GetConversation(id)
 	if err != nil {
@@ -139,7 +209,7 @@ func (m *Manager) LoadConversation(id string) (*Conversation, []*Message, error)
 		return nil, nil, fmt.Errorf("conversation not found: %s", id)
 	}
 
-	messages, err := m.store.GetMessages(id)
+	messages, err := m.store.GetActivePath(id)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -151,9 +221,56 @@ func (m *Manager) LoadConversation(id string) (*Conversation, []*Message, error)
 	return conv, messages, nil
 }
 
-// ListConversations returns all conversations
-func (m *Manager) ListConversations(limit int) ([]*Conversation, error) {
-	return m.store.ListConversations(limit, false)
+// ListConversations returns conversations matching filter, pinned first
+func (m *Manager) ListConversations(limit int, filter ArchiveFilter) ([]*Conversation, error) {
+	return m.store.ListConversations(limit, filter)
+}
+
+// ConversationUpdate lists the fields to change; nil fields are left
+// unchanged
+type ConversationUpdate struct {
+	Title    *string
+	Archived *bool
+	Pinned   *bool
+}
+
+// UpdateConversation renames, archives and/or pins a conversation
+func (m *Manager) UpdateConversation(id string, update ConversationUpdate) (*Conversation, error) {
+	conv, err := m.store.GetConversation(id)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, fmt.Errorf("conversation not found: %s", id)
+	}
+
+	if update.Title != nil {
+		if err := m.store.UpdateConversationTitle(id, *update.Title); err != nil {
+			return nil, fmt.Errorf("rename conversation: %w", err)
+		}
+	}
+	if update.Archived != nil {
+		if err := m.store.SetConversationArchived(id, *update.Archived); err != nil {
+			return nil, fmt.Errorf("archive conversation: %w", err)
+		}
+	}
+	if update.Pinned != nil {
+		if err := m.store.SetConversationPinned(id, *update.Pinned); err != nil {
+			return nil, fmt.Errorf("pin conversation: %w", err)
+		}
+	}
+
+	return m.store.GetConversation(id)
+}
+
+// Search finds messages and conversation titles matching query
+func (m *Manager) Search(query string, limit int, includeArchived bool) ([]*SearchResult, error) {
+	return m.store.Search(query, limit, includeArchived)
+}
+
+// FullTextSearch reports whether search uses the FTS5 index
+func (m *Manager) FullTextSearch() bool {
+	return m.store.FullTextSearch()
 }
 
 // DeleteConversation deletes a conversation
@@ -167,8 +284,8 @@ func (m *Manager) DeleteConversation(id string) error {
 	return m.store.DeleteConversation(id)
 }
 
-// Chat sends a message and gets a response
-func (m *Manager) Chat(ctx context.Context, conversationID, content string) (*Message, error) {
+// Chat sends a message (with optional attachments) and gets a response
+func (m *Manager) Chat(ctx context.Context, conversationID, content string, attachments ...*Attachment) (*ChatResult, error) {
 	// Ensure conversation exists
 	conv, err := m.store.GetConversation(conversationID)
 	if err != nil {
@@ -178,39 +295,240 @@ func (m *Manager) Chat(ctx context.Context, conversationID, content string) (*Me
 		return nil, fmt.Errorf("conversation not found: %s", conversationID)
 	}
 
-	// Estimate tokens (rough: ~4 chars per token for English)
-	userTokens := len(content) / 4
-	if userTokens < 1 {
-		userTokens = 1
+	// Estimate tokens
+	userTokens := messageTokens(&Message{Content: content, Attachments: attachments})
+
+	// Save user message with token estimate, continuing the active branch
+	userMsg, err := m.store.AddMessage(conversationID, conv.ActiveLeaf, "user", content, userTokens)
+	if err != nil {
+		return nil, fmt.Errorf("save user message: %w", err)
+	}
+
+	if err := m.store.AddAttachments(userMsg.ID, attachments); err != nil {
+		m.store.DeleteMessage(userMsg.ID)
+		return nil, fmt.Errorf("save attachments: %w", err)
+	}
+
+	history, err := m.store.GetPath(userMsg.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get messages: %w", err)
+	}
+
+	result, err := m.respond(ctx, conv, history)
+	if err != nil {
+		return nil, err
+	}
+
+	m.updateTitle(conversationID, content)
+	return result, nil
+}
+
+// EditMessage replaces a user message with new content on a branch of
+// its own: the edit becomes a sibling of the original, which keeps its
+// replies, and gets a fresh reply. Attachments carry over to the edit.
+func (m *Manager) EditMessage(ctx context.Context, conversationID, messageID, content string) (*ChatResult, error) {
+	conv, err := m.store.GetConversation(conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("get conversation: %w", err)
+	}
+	if conv == nil {
+		return nil, fmt.Errorf("conversation not found: %s", conversationID)
+	}
+
+	original, err := m.store.GetMessage(messageID)
+	if err != nil {
+		return nil, fmt.Errorf("get message: %w", err)
+	}
+	if original == nil || original.ConversationID != conversationID {
+		return nil, fmt.Errorf("message not found: %s", messageID)
 	}
+	if original.Role != "user" {
+		return nil, ErrNotEditable
+	}
+
+	userTokens := messageTokens(&Message{Content: content, Attachments: original.Attachments})
 
-	// Save user message with token estimate
-	_, err = m.store.AddMessage(conversationID, "user", content, userTokens)
+	userMsg, err := m.store.AddMessage(conversationID, original.ParentID, "user", content, userTokens)
 	if err != nil {
 		return nil, fmt.Errorf("save user message: %w", err)
 	}
 
-	// Get conversation history
-	messages, err := m.store.GetRecentMessages(conversationID, 20) // Last 20 messages
+	if err := m.store.AddAttachments(userMsg.ID, original.Attachments); err != nil {
+		m.store.DeleteMessage(userMsg.ID)
+		m.store.SetActiveLeaf(conversationID, conv.ActiveLeaf)
+		return nil, fmt.Errorf("save attachments: %w", err)
+	}
+
+	history, err := m.store.GetPath(userMsg.ID)
 	if err != nil {
 		return nil, fmt.Errorf("get messages: %w", err)
 	}
 
-	// Convert to provider messages
-	providerMsgs := make([]providers.Message, 0, len(messages))
-	for _, msg := range messages {
-		providerMsgs = append(providerMsgs, providers.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
+	result, err := m.respond(ctx, conv, history)
+	if err != nil {
+		// Drop an edit that got no reply, so that resending it does not
+		// leave an empty branch behind
+		if leaf, lerr := m.store.GetConversation(conversationID); lerr == nil && leaf != nil && leaf.ActiveLeaf == userMsg.ID {
+			m.store.DeleteMessage(userMsg.ID)
+			m.store.SetActiveLeaf(conversationID, conv.ActiveLeaf)
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// Regenerate asks the provider again for the user turn answered by
+// messageID (default: the last reply on the active branch). The new reply
+// is stored as another version next to the old one and becomes active.
+// Without messageID, a branch ending in an unanswered message is refused:
+// that turn needs Retry, not another version of the exchange before it.
+func (m *Manager) Regenerate(ctx context.Context, conversationID, messageID string) (*ChatResult, error) {
+	conv, err := m.store.GetConversation(conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("get conversation: %w", err)
+	}
+	if conv == nil {
+		return nil, fmt.Errorf("conversation not found: %s", conversationID)
 	}
 
+	var reply *Message
+	if messageID == "" {
+		path, err := m.store.GetActivePath(conversationID)
+		if err != nil {
+			return nil, fmt.Errorf("get messages: %w", err)
+		}
+		if len(path) > 0 && path[len(path)-1].Role == "user" {
+			return nil, fmt.Errorf("%w: the last message has no reply yet, retry it instead", ErrNothingToRegenerate)
+		}
+		for i := len(path) - 1; i >= 0 && reply == nil; i-- {
+			if path[i].Role == "assistant" {
+				reply = path[i]
+			}
+		}
+	} else if reply, err = m.store.GetMessage(messageID); err != nil {
+		return nil, fmt.Errorf("get message: %w", err)
+	}
+	if reply == nil || reply.ConversationID != conversationID || reply.Role != "assistant" || reply.ParentID == "" {
+		return nil, ErrNothingToRegenerate
+	}
+
+	history, err := m.store.GetPath(reply.ParentID)
+	if err != nil {
+		return nil, fmt.Errorf("get messages: %w", err)
+	}
+	if len(history) == 0 || history[len(history)-1].Role != "user" {
+		return nil, ErrNothingToRegenerate
+	}
+
+	return m.respond(ctx, conv, history)
+}
+
+// SwitchBranch makes the conversation continue from messageID's branch,
+// following the newest replies below it, and returns the new path.
+// A version > 0 picks that sibling of messageID instead (1-based), for
+// paging between edits or regenerated replies.
+func (m *Manager) SwitchBranch(conversationID, messageID string, version int) (*Conversation, []*Message, error) {
+	if version > 0 {
+		sibling, err := m.store.SiblingAt(messageID, version)
+		if err != nil {
+			return nil, nil, err
+		}
+		messageID = sibling
+	}
+
+	leaf, err := m.store.LatestLeaf(messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := m.store.SetActiveLeaf(conversationID, leaf); err != nil {
+		return nil, nil, err
+	}
+	return m.LoadConversation(conversationID)
+}
+
+// Retry regenerates the reply to the last user message of the active branch.
+// The user message is reused as-is; any partial assistant reply left behind
+// by the failed attempt is discarded first.
+func (m *Manager) Retry(ctx context.Context, conversationID string) (*ChatResult, error) {
+	conv, err := m.store.GetConversation(conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("get conversation: %w", err)
+	}
+	if conv == nil {
+		return nil, fmt.Errorf("conversation not found: %s", conversationID)
+	}
+
+	messages, err := m.store.GetActivePath(conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("get messages: %w", err)
+	}
+
+	// Drop trailing partial replies until we reach the last user message
+	var lastUser *Message
+	var partial []*Message
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Role == "user" {
+			lastUser = msg
+			messages = messages[:i+1]
+			break
+		}
+		if msg.Role != "assistant" || !isPartialReply(msg.Content) {
+			return nil, ErrNothingToRetry
+		}
+		partial = append(partial, msg)
+	}
+	if lastUser == nil {
+		return nil, ErrNothingToRetry
+	}
+
+	for _, msg := range partial {
+		if err := m.store.DeleteMessage(msg.ID); err != nil {
+			return nil, fmt.Errorf("discard partial reply: %w", err)
+		}
+	}
+
+	result, err := m.respond(ctx, conv, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	m.updateTitle(conversationID, lastUser.Content)
+	return result, nil
+}
+
+// isPartialReply reports whether an assistant reply was cut short
+func isPartialReply(content string) bool {
+	return strings.HasSuffix(content, IncompleteMarker) || strings.HasSuffix(content, CancelledMarker)
+}
+
+// respond streams a new assistant reply to history, the branch ending
+// with the user message being answered
+func (m *Manager) respond(ctx context.Context, conv *Conversation, history []*Message) (*ChatResult, error) {
+	conversationID := conv.ID
+	parentID := history[len(history)-1].ID
+	started := time.Now()
+
 	// Get current model from provider if available
+	provider := m.currentProvider()
 	model := conv.Model
-	if gm, ok := m.provider.(interface{ GetModel() string }); ok {
+	if gm, ok := provider.(interface{ GetModel() string }); ok {
 		model = gm.GetModel()
 	}
 
+	// Send as much of the branch as fits the model's context window
+	budget := m.historyBudget(provider, model)
+	messages := fitHistory(history, budget)
+	if len(messages) < len(history) {
+		log.Printf("Context: sending %d of %d messages (%s, %d token budget)", len(messages), len(history), model, budget)
+	}
+
+	// Convert to provider messages
+	providerMsgs := make([]providers.Message, 0, len(messages))
+	for _, msg := range messages {
+		providerMsgs = append(providerMsgs, providerMessage(msg))
+	}
+
 	// Prepare request
 	req := &providers.ChatRequest{
 		Messages:     providerMsgs,
@@ -225,59 +543,140 @@ func (m *Manager) Chat(ctx context.Context, conversationID, content string) (*Me
 	// Stream callback - accumulate content
 	var fullContent string
 	streamFn := func(chunk *providers.StreamChunk) error {
+		// Stop the provider stream as soon as the request is cancelled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if chunk.Content != "" {
 			fullContent += chunk.Content
 			if m.onStreamChunk != nil {
-				m.onStreamChunk(conversationID, assistantMsgID, chunk.Content, false)
+				m.onStreamChunk(ctx, conversationID, assistantMsgID, chunk.Content, false)
 			}
 		}
 		if chunk.Done && m.onStreamChunk != nil {
-			m.onStreamChunk(conversationID, assistantMsgID, "", true)
+			m.onStreamChunk(ctx, conversationID, assistantMsgID, "", true)
 		}
 		return nil
 	}
 
 	// Execute with resilience
 	var resp *providers.ChatResponse
-	err = m.executor.Execute(ctx, func(ctx context.Context) error {
+	err := m.executor.Execute(ctx, func(ctx context.Context) error {
 		var chatErr error
-		resp, chatErr = m.provider.Chat(ctx, req, streamFn)
+		resp, chatErr = provider.Chat(ctx, req, streamFn)
 		return chatErr
 	}, m.isRetryable)
 
 	if err != nil {
+		// Cancelled by the client - keep the partial reply marked as cancelled
+		if ctxErr := ctx.Err(); errors.Is(ctxErr, context.Canceled) {
+			if fullContent != "" {
+				tokens := EstimateTokens(fullContent)
+				m.store.AddMessageWithID(conversationID, assistantMsgID, parentID, "assistant", fullContent+" "+CancelledMarker, tokens)
+			}
+			return nil, fmt.Errorf("chat: %w", ctxErr)
+		}
+
+		m.recordFailure(provider.Name(), err)
+
 		// Save partial response if we have content
 		if fullContent != "" {
-			tokens := len(fullContent) / 4
-			m.store.AddMessageWithID(conversationID, assistantMsgID, "assistant", fullContent+" [incomplete]", tokens)
+			tokens := EstimateTokens(fullContent)
+			m.store.AddMessageWithID(conversationID, assistantMsgID, parentID, "assistant", fullContent+" "+IncompleteMarker, tokens)
 		}
 		return nil, fmt.Errorf("chat: %w", err)
 	}
 
 	// Estimate assistant tokens
-	assistantTokens := len(resp.Content) / 4
+	assistantTokens := EstimateTokens(resp.Content)
 	if assistantTokens < 1 {
 		assistantTokens = 1
 	}
 
 	// Save assistant message with pre-generated ID
-	assistantMsg, err := m.store.AddMessageWithID(conversationID, assistantMsgID, "assistant", resp.Content, assistantTokens)
+	assistantMsg, err := m.store.AddMessageWithID(conversationID, assistantMsgID, parentID, "assistant", resp.Content, assistantTokens)
 	if err != nil {
 		return nil, fmt.Errorf("save assistant message: %w", err)
 	}
+	if err := m.store.siblingPosition(assistantMsg); err != nil {
+		log.Printf("Failed to count reply versions: %v", err)
+	}
+
+	// Prefer the model the provider reports actually serving the request
+	if resp.Model != "" {
+		model = resp.Model
+	}
+
+	return &ChatResult{
+		Message:      assistantMsg,
+		Provider:     provider.Name(),
+		Model:        model,
+		FinishReason: resp.FinishReason,
+		Usage:        resp.TokensUsed,
+		Latency:      time.Since(started),
+	}, nil
+}
+
+// historyBudget returns the tokens left for history in the model's
+// context window once the system prompt and the reply are accounted for
+func (m *Manager) historyBudget(provider providers.Provider, model string) int {
+	window, ok := m.contextLimits[model]
+	if !ok {
+		window = providers.ContextWindow(model)
+	}
+	// A window too small for the reply still gets the turn being answered
+	return max(0, window-messageOverhead-EstimateTokens(m.systemPrompt)-providers.MaxOutputTokens(provider))
+}
+
+// recordFailure remembers the last provider error
+func (m *Manager) recordFailure(providerName string, err error) {
+	failure := &ProviderFailure{
+		Provider: providerName,
+		Message:  err.Error(),
+		At:       time.Now(),
+	}
+
+	var pe *providers.ProviderError
+	if errors.As(err, &pe) {
+		failure.Code = pe.Code
+		failure.Message = pe.Message
+	}
+
+	m.lastErrMu.Lock()
+	m.lastErr = failure
+	m.lastErrMu.Unlock()
+}
 
-	// Update conversation title if it's the first message
+// LastFailure returns the most recent provider error (nil if none)
+func (m *Manager) LastFailure() *ProviderFailure {
+	m.lastErrMu.Lock()
+	defer m.lastErrMu.Unlock()
+	return m.lastErr
+}
+
+// CircuitState returns the provider circuit breaker state
+func (m *Manager) CircuitState() string {
+	return m.executor.CircuitState().String()
+}
+
+// DiskSize returns the size of the conversation database in bytes
+func (m *Manager) DiskSize() int64 {
+	return m.store.DiskSize()
+}
+
+// updateTitle sets the conversation title after the first exchange
+func (m *Manager) updateTitle(conversationID, content string) {
 	count, _ := m.store.CountMessages(conversationID)
-	if count <= 2 {
-		// Generate title from first user message
-		title := content
-		if len(title) > 50 {
-			title = title[:50] + "..."
-		}
-		m.store.UpdateConversationTitle(conversationID, title)
+	if count > 2 {
+		return
 	}
 
-	return assistantMsg, nil
+	// Generate title from first user message
+	title := content
+	if len(title) > 50 {
+		title = title[:50] + "..."
+	}
+	m.store.UpdateConversationTitle(conversationID, title)
 }
 
 // isRetryable checks if an error should be retried
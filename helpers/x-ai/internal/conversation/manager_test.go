@@ -0,0 +1,297 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"x-ai/internal/providers"
+)
+
+// fakeProvider answers "reply N" (N counting calls), or fails while fail is set
+type fakeProvider struct {
+	calls int
+	fail  bool
+	last  *providers.ChatRequest
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) Chat(ctx context.Context, req *providers.ChatRequest, stream providers.StreamCallback) (*providers.ChatResponse, error) {
+	p.last = req
+	if p.fail {
+		return nil, &providers.ProviderError{Provider: "fake", Message: "down"}
+	}
+	p.calls++
+	content := fmt.Sprintf("reply %d", p.calls)
+	return &providers.ChatResponse{Content: content, Model: req.Model, FinishReason: "stop"}, nil
+}
+
+func (p *fakeProvider) ValidateConnection(ctx context.Context) error { return nil }
+
+func (p *fakeProvider) ListModels(ctx context.Context) ([]providers.Model, error) { return nil, nil }
+
+// newTestManager opens a manager on a fresh data directory
+func newTestManager(t *testing.T) (*Manager, *fakeProvider) {
+	t.Helper()
+
+	provider := &fakeProvider{}
+	m, err := NewManager(ManagerConfig{DataDir: t.TempDir()}, provider)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m, provider
+}
+
+// activePath returns role:content for each message of the active branch
+func activePath(t *testing.T, m *Manager, convID string) []string {
+	t.Helper()
+
+	_, messages, err := m.LoadConversation(convID)
+	if err != nil {
+		t.Fatalf("LoadConversation: %v", err)
+	}
+	path := make([]string, len(messages))
+	for i, msg := range messages {
+		path[i] = msg.Role + ":" + msg.Content
+	}
+	return path
+}
+
+// equalPaths reports whether two paths match
+func equalPaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRegenerateRefusesUnansweredTurn(t *testing.T) {
+	m, provider := newTestManager(t)
+	ctx := context.Background()
+
+	conv, err := m.NewConversation("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Chat(ctx, conv.ID, "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second turn fails, leaving the branch ending in its prompt
+	provider.fail = true
+	if _, err := m.Chat(ctx, conv.ID, "second"); err == nil {
+		t.Fatal("Chat succeeded with a failing provider")
+	}
+	provider.fail = false
+	want := []string{"user:first", "assistant:reply 1", "user:second"}
+
+	tests := []struct {
+		name      string
+		messageID func() string
+		wantErr   error
+		wantPath  []string
+	}{
+		{"default reply", func() string { return "" }, ErrNothingToRegenerate, want},
+		{"explicit earlier reply", func() string {
+			_, messages, _ := m.LoadConversation(conv.ID)
+			return messages[1].ID
+		}, nil, []string{"user:first", "assistant:reply 2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Regenerate(ctx, conv.ID, tt.messageID())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Regenerate error = %v, want %v", err, tt.wantErr)
+			}
+			if got := activePath(t, m, conv.ID); !equalPaths(got, tt.wantPath) {
+				t.Errorf("active path = %q, want %q", got, tt.wantPath)
+			}
+		})
+	}
+}
+
+// sentHistory returns role:content for each message of the last provider call
+func sentHistory(p *fakeProvider) []string {
+	sent := make([]string, len(p.last.Messages))
+	for i, msg := range p.last.Messages {
+		sent[i] = msg.Role + ":" + msg.Content
+	}
+	return sent
+}
+
+// siblings returns index/count for each message of the active branch
+func siblings(t *testing.T, m *Manager, convID string) []string {
+	t.Helper()
+
+	_, messages, err := m.LoadConversation(convID)
+	if err != nil {
+		t.Fatalf("LoadConversation: %v", err)
+	}
+	got := make([]string, len(messages))
+	for i, msg := range messages {
+		got[i] = fmt.Sprintf("%d/%d", msg.SiblingIndex, msg.SiblingCount)
+	}
+	return got
+}
+
+func TestEditAndSwitchBranch(t *testing.T) {
+	m, provider := newTestManager(t)
+	ctx := context.Background()
+
+	conv, err := m.NewConversation("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"first", "second"} {
+		if _, err := m.Chat(ctx, conv.ID, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, messages, _ := m.LoadConversation(conv.ID)
+	second := messages[2].ID
+
+	if _, err := m.EditMessage(ctx, conv.ID, messages[1].ID, "nope"); !errors.Is(err, ErrNotEditable) {
+		t.Fatalf("editing a reply: %v, want ErrNotEditable", err)
+	}
+	edited, err := m.EditMessage(ctx, conv.ID, second, "second, edited")
+	if err != nil {
+		t.Fatalf("EditMessage: %v", err)
+	}
+	_, messages, _ = m.LoadConversation(conv.ID)
+	edit := messages[2].ID
+	if messages[3].ID != edited.Message.ID {
+		t.Errorf("the edit's reply is not on the active branch")
+	}
+
+	tests := []struct {
+		name     string
+		action   func() error
+		wantPath []string
+		wantSibs []string
+		wantSent []string // History of the last provider call
+	}{
+		{"edit is a sibling with its own reply", func() error { return nil },
+			[]string{"user:first", "assistant:reply 1", "user:second, edited", "assistant:reply 3"},
+			[]string{"1/1", "1/1", "2/2", "1/1"},
+			[]string{"user:first", "assistant:reply 1", "user:second, edited"}},
+		{"switch back by version", func() error {
+			_, _, err := m.SwitchBranch(conv.ID, edit, 1)
+			return err
+		},
+			[]string{"user:first", "assistant:reply 1", "user:second", "assistant:reply 2"},
+			[]string{"1/1", "1/1", "1/2", "1/1"},
+			nil},
+		{"chat continues the switched branch", func() error {
+			_, err := m.Chat(ctx, conv.ID, "third")
+			return err
+		},
+			[]string{"user:first", "assistant:reply 1", "user:second", "assistant:reply 2", "user:third", "assistant:reply 4"},
+			[]string{"1/1", "1/1", "1/2", "1/1", "1/1", "1/1"},
+			[]string{"user:first", "assistant:reply 1", "user:second", "assistant:reply 2", "user:third"}},
+		{"switch to a message follows its newest replies", func() error {
+			_, _, err := m.SwitchBranch(conv.ID, edit, 0)
+			return err
+		},
+			[]string{"user:first", "assistant:reply 1", "user:second, edited", "assistant:reply 3"},
+			[]string{"1/1", "1/1", "2/2", "1/1"},
+			nil},
+		{"missing version", func() error {
+			if _, _, err := m.SwitchBranch(conv.ID, edit, 3); err == nil {
+				return errors.New("switched to version 3 of 2")
+			}
+			return nil
+		},
+			[]string{"user:first", "assistant:reply 1", "user:second, edited", "assistant:reply 3"},
+			[]string{"1/1", "1/1", "2/2", "1/1"},
+			nil},
+	}
+
+	// Steps build on each other, so they share one conversation
+	for _, tt := range tests {
+		if err := tt.action(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := activePath(t, m, conv.ID); !equalPaths(got, tt.wantPath) {
+			t.Errorf("%s: active path = %q, want %q", tt.name, got, tt.wantPath)
+		}
+		if got := siblings(t, m, conv.ID); !equalPaths(got, tt.wantSibs) {
+			t.Errorf("%s: siblings = %q, want %q", tt.name, got, tt.wantSibs)
+		}
+		if tt.wantSent != nil {
+			if got := sentHistory(provider); !equalPaths(got, tt.wantSent) {
+				t.Errorf("%s: sent history = %q, want %q", tt.name, got, tt.wantSent)
+			}
+		}
+	}
+}
+
+func TestRegenerateVersions(t *testing.T) {
+	m, provider := newTestManager(t)
+	ctx := context.Background()
+
+	conv, err := m.NewConversation("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := m.Chat(ctx, conv.ID, "question")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		action   func() error
+		wantPath []string
+		wantSibs []string
+	}{
+		{"second version", func() error {
+			_, err := m.Regenerate(ctx, conv.ID, "")
+			return err
+		}, []string{"user:question", "assistant:reply 2"}, []string{"1/1", "2/2"}},
+		{"third version", func() error {
+			_, err := m.Regenerate(ctx, conv.ID, "")
+			return err
+		}, []string{"user:question", "assistant:reply 3"}, []string{"1/1", "3/3"}},
+		{"page back to the first", func() error {
+			_, _, err := m.SwitchBranch(conv.ID, first.Message.ID, 1)
+			return err
+		}, []string{"user:question", "assistant:reply 1"}, []string{"1/1", "1/3"}},
+		{"regenerate from an older version", func() error {
+			_, err := m.Regenerate(ctx, conv.ID, "")
+			return err
+		}, []string{"user:question", "assistant:reply 4"}, []string{"1/1", "4/4"}},
+		{"user message by ID", func() error {
+			_, messages, _ := m.LoadConversation(conv.ID)
+			if _, err := m.Regenerate(ctx, conv.ID, messages[0].ID); !errors.Is(err, ErrNothingToRegenerate) {
+				return fmt.Errorf("got %v, want ErrNothingToRegenerate", err)
+			}
+			return nil
+		}, []string{"user:question", "assistant:reply 4"}, []string{"1/1", "4/4"}},
+	}
+
+	for _, tt := range tests {
+		if err := tt.action(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := activePath(t, m, conv.ID); !equalPaths(got, tt.wantPath) {
+			t.Errorf("%s: active path = %q, want %q", tt.name, got, tt.wantPath)
+		}
+		if got := siblings(t, m, conv.ID); !equalPaths(got, tt.wantSibs) {
+			t.Errorf("%s: siblings = %q, want %q", tt.name, got, tt.wantSibs)
+		}
+	}
+
+	// Old versions are never sent back to the provider
+	if got, want := sentHistory(provider), []string{"user:question"}; !equalPaths(got, want) {
+		t.Errorf("sent history = %q, want %q", got, want)
+	}
+}
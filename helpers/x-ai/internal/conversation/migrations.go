@@ -0,0 +1,337 @@
+// Package conversation - versioned schema migrations
+package conversation
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// maxBackups is how many pre-migration backups are kept
+const maxBackups = 5
+
+// migration is one schema change. Steps run in order, each in its own
+// transaction, and must be idempotent: databases created before
+// versioning already contain some of them.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change, oldest first. Never edit or
+// reorder a released step; append a new one instead.
+var migrations = []migration{
+	{1, "conversations and messages", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS conversations (
+				id TEXT PRIMARY KEY,
+				title TEXT NOT NULL,
+				provider TEXT NOT NULL,
+				model TEXT NOT NULL,
+				created_at INTEGER NOT NULL,
+				updated_at INTEGER NOT NULL,
+				archived INTEGER DEFAULT 0
+			);
+
+			CREATE TABLE IF NOT EXISTS messages (
+				id TEXT PRIMARY KEY,
+				conversation_id TEXT NOT NULL,
+				role TEXT NOT NULL,
+				content TEXT NOT NULL,
+				token_count INTEGER DEFAULT 0,
+				created_at INTEGER NOT NULL,
+				FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_messages_conv ON messages(conversation_id);
+			CREATE INDEX IF NOT EXISTS idx_messages_created ON messages(created_at);
+			CREATE INDEX IF NOT EXISTS idx_conversations_updated ON conversations(updated_at DESC);
+		`)
+		return err
+	}},
+	{2, "attachments", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS attachments (
+				id TEXT PRIMARY KEY,
+				message_id TEXT NOT NULL,
+				name TEXT NOT NULL,
+				path TEXT NOT NULL,
+				mime_type TEXT NOT NULL,
+				size INTEGER NOT NULL,
+				content TEXT NOT NULL,
+				created_at INTEGER NOT NULL,
+				FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_attachments_message ON attachments(message_id);
+		`)
+		return err
+	}},
+	{3, "image attachment data", func(tx *sql.Tx) error {
+		return addColumn(tx, "attachments", "data", "BLOB")
+	}},
+	{4, "pinned conversations", func(tx *sql.Tx) error {
+		return addColumn(tx, "conversations", "pinned", "INTEGER DEFAULT 0")
+	}},
+	{5, "message branches", func(tx *sql.Tx) error {
+		if err := addColumn(tx, "messages", "parent_id", "TEXT"); err != nil {
+			return err
+		}
+		if err := addColumn(tx, "conversations", "active_leaf", "TEXT"); err != nil {
+			return err
+		}
+
+		// Existing conversations become a single branch in message order
+		_, err := tx.Exec(`
+			UPDATE messages SET parent_id = (
+				SELECT p.id FROM messages p
+				WHERE p.conversation_id = messages.conversation_id
+				  AND (p.created_at < messages.created_at
+				       OR (p.created_at = messages.created_at AND p.rowid < messages.rowid))
+				ORDER BY p.created_at DESC, p.rowid DESC
+				LIMIT 1
+			)
+			WHERE parent_id IS NULL;
+
+			UPDATE conversations SET active_leaf = (
+				SELECT m.id FROM messages m
+				WHERE m.conversation_id = conversations.id
+				ORDER BY m.created_at DESC, m.rowid DESC
+				LIMIT 1
+			)
+			WHERE active_leaf IS NULL;
+
+			CREATE INDEX IF NOT EXISTS idx_messages_parent ON messages(conversation_id, parent_id);
+		`)
+		return err
+	}},
+}
+
+// SchemaVersion is the schema version this build expects
+var SchemaVersion = migrations[len(migrations)-1].version
+
+// MigrationInfo describes a migration step
+type MigrationInfo struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+// MigrationStatus describes the schema of a database
+type MigrationStatus struct {
+	Path    string          `json:"path"`
+	Exists  bool            `json:"exists"`
+	Version int             `json:"version"` // 0 for new or pre-versioning databases
+	Latest  int             `json:"latest"`
+	Pending []MigrationInfo `json:"pending"`
+}
+
+// MigrationResult reports what a migration run did
+type MigrationResult struct {
+	From    int             `json:"from"`
+	To      int             `json:"to"`
+	Applied []MigrationInfo `json:"applied"`
+	Backup  string          `json:"backup,omitempty"` // Copy taken before migrating
+}
+
+// dbPath returns the database file of a data directory
+func dbPath(dataDir string) string {
+	return filepath.Join(dataDir, "db", "conversations.db")
+}
+
+// CheckMigrations reports pending migrations without changing anything
+func CheckMigrations(dataDir string) (*MigrationStatus, error) {
+	status := &MigrationStatus{
+		Path:   dbPath(dataDir),
+		Latest: SchemaVersion,
+	}
+
+	if _, err := os.Stat(status.Path); err == nil {
+		status.Exists = true
+
+		db, err := sql.Open("sqlite3", "file:"+status.Path+"?mode=ro&_busy_timeout=5000")
+		if err != nil {
+			return nil, fmt.Errorf("open database: %w", err)
+		}
+		defer db.Close()
+
+		if status.Version, err = schemaVersion(db); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	status.Pending = pendingMigrations(status.Version)
+	return status, nil
+}
+
+// Migrate brings a database up to date, creating it if needed
+func Migrate(dataDir string) (*MigrationResult, error) {
+	store, result, err := openStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	store.Close()
+	return result, nil
+}
+
+// pendingMigrations lists the steps after version
+func pendingMigrations(version int) []MigrationInfo {
+	pending := []MigrationInfo{}
+	for _, m := range migrations {
+		if m.version > version {
+			pending = append(pending, MigrationInfo{Version: m.version, Name: m.name})
+		}
+	}
+	return pending
+}
+
+// schemaVersion returns the applied schema version (0 if unversioned)
+func schemaVersion(db *sql.DB) (int, error) {
+	var exists int
+	if err := db.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'
+	`).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	if exists == 0 {
+		return 0, nil
+	}
+
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrate applies pending migrations, backing the database up first.
+// The full-text index is set up afterwards on every start, since it
+// depends on how SQLite was built rather than on the schema version.
+func (s *Store) migrate() (*MigrationResult, error) {
+	version, err := schemaVersion(s.db)
+	if err != nil {
+		return nil, err
+	}
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("database schema v%d is newer than this build (v%d)", version, SchemaVersion)
+	}
+
+	result := &MigrationResult{From: version, To: version, Applied: []MigrationInfo{}}
+
+	if version < SchemaVersion {
+		if s.hasData() {
+			if result.Backup, err = s.backup(version); err != nil {
+				return nil, err
+			}
+			log.Printf("Database backed up to %s", result.Backup)
+		}
+
+		if _, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS schema_version (
+				version INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at INTEGER NOT NULL
+			)
+		`); err != nil {
+			return nil, fmt.Errorf("create schema_version: %w", err)
+		}
+
+		for _, m := range migrations {
+			if m.version <= version {
+				continue
+			}
+			if err := s.apply(m); err != nil {
+				return nil, fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+			log.Printf("Applied migration %d: %s", m.version, m.name)
+			result.Applied = append(result.Applied, MigrationInfo{Version: m.version, Name: m.name})
+			result.To = m.version
+		}
+	}
+
+	if err := s.migrateSearch(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// apply runs one migration and records it in the same transaction
+func (s *Store) apply(m migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)
+	`, m.version, m.name, time.Now().Unix()); err != nil {
+		return fmt.Errorf("record version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// hasData reports whether the database has any tables yet
+func (s *Store) hasData() bool {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&count)
+	return err != nil || count > 0 // Back up when unsure
+}
+
+// backup copies the database with VACUUM INTO and prunes old copies
+func (s *Store) backup(version int) (string, error) {
+	dir := filepath.Join(s.dataDir, "db", "backups")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("create backup dir: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("conversations-%s-v%d.db", time.Now().Format("20060102-150405"), version))
+	if _, err := s.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return "", fmt.Errorf("backup database: %w", err)
+	}
+
+	pruneBackups(dir)
+	return path, nil
+}
+
+// pruneBackups keeps the newest maxBackups copies
+func pruneBackups(dir string) {
+	matches, err := filepath.Glob(filepath.Join(dir, "conversations-*.db"))
+	if err != nil || len(matches) <= maxBackups {
+		return
+	}
+
+	sort.Strings(matches) // Timestamped names sort oldest first
+	for _, path := range matches[:len(matches)-maxBackups] {
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to remove old backup %s: %v", path, err)
+		}
+	}
+}
+
+// addColumn adds a column to an existing table if it is missing
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	var count int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?
+	`, table, column).Scan(&count); err != nil {
+		return fmt.Errorf("table info %s: %w", table, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
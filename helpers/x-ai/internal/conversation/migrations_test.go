@@ -0,0 +1,175 @@
+package conversation
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// createV1Database writes a database as built before versioning: the
+// original tables, no schema_version, one conversation of three messages
+// (two sharing a timestamp)
+func createV1Database(t *testing.T, dataDir string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(dbPath(dataDir)), 0700); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", dbPath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrations[0].up(tx); err != nil {
+		t.Fatalf("v1 schema: %v", err)
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO conversations (id, title, provider, model, created_at, updated_at)
+		VALUES ('c1', 'Old chat', 'openai', 'gpt-4o', 100, 102);
+
+		INSERT INTO messages (id, conversation_id, role, content, created_at) VALUES
+			('m1', 'c1', 'user', 'hi', 100),
+			('m2', 'c1', 'assistant', 'hello', 101),
+			('m3', 'c1', 'user', 'again', 101);
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// backups lists the backup files of a data directory
+func backups(t *testing.T, dataDir string) []string {
+	t.Helper()
+
+	matches, err := filepath.Glob(filepath.Join(dataDir, "db", "backups", "conversations-*.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	dataDir := t.TempDir()
+	createV1Database(t, dataDir)
+
+	// Leftovers from earlier upgrades, older than any new backup
+	backupDir := filepath.Join(dataDir, "db", "backups")
+	if err := os.MkdirAll(backupDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"20200101-000000", "20200102-000000", "20200103-000000", "20200104-000000", "20200105-000000"} {
+		if err := os.WriteFile(filepath.Join(backupDir, "conversations-"+name+"-v3.db"), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, err := CheckMigrations(dataDir)
+	if err != nil {
+		t.Fatalf("CheckMigrations: %v", err)
+	}
+	if !status.Exists || status.Version != 0 || len(status.Pending) != SchemaVersion {
+		t.Fatalf("status = %+v, want an existing v0 database with %d pending steps", status, SchemaVersion)
+	}
+
+	result, err := Migrate(dataDir)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if result.From != 0 || result.To != SchemaVersion || len(result.Applied) != SchemaVersion {
+		t.Errorf("result = %+v, want v0 to v%d", result, SchemaVersion)
+	}
+
+	// A fresh backup was taken and only the newest maxBackups kept
+	if _, err := os.Stat(result.Backup); err != nil {
+		t.Errorf("backup: %v", err)
+	}
+	got := backups(t, dataDir)
+	if len(got) != maxBackups {
+		t.Errorf("%d backups kept, want %d", len(got), maxBackups)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "conversations-20200101-000000-v3.db")); !os.IsNotExist(err) {
+		t.Error("oldest backup was not pruned")
+	}
+
+	// The old messages became one branch in creation order
+	db, err := sql.Open("sqlite3", dbPath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		id     string
+		parent sql.NullString
+	}{
+		{"m1", sql.NullString{}},
+		{"m2", sql.NullString{String: "m1", Valid: true}},
+		{"m3", sql.NullString{String: "m2", Valid: true}},
+	}
+	for _, tt := range tests {
+		var parent sql.NullString
+		if err := db.QueryRow(`SELECT parent_id FROM messages WHERE id = ?`, tt.id).Scan(&parent); err != nil {
+			t.Fatal(err)
+		}
+		if parent != tt.parent {
+			t.Errorf("%s parent = %v, want %v", tt.id, parent, tt.parent)
+		}
+	}
+	var leaf string
+	if err := db.QueryRow(`SELECT active_leaf FROM conversations WHERE id = 'c1'`).Scan(&leaf); err != nil {
+		t.Fatal(err)
+	}
+	if leaf != "m3" {
+		t.Errorf("active leaf = %q, want m3", leaf)
+	}
+
+	// Nothing is left to do
+	status, err = CheckMigrations(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != SchemaVersion || len(status.Pending) != 0 {
+		t.Errorf("after Migrate: %+v", status)
+	}
+	result, err = Migrate(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Applied) != 0 || result.Backup != "" {
+		t.Errorf("second Migrate = %+v, want a no-op", result)
+	}
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	dataDir := t.TempDir()
+
+	status, err := CheckMigrations(dataDir)
+	if err != nil {
+		t.Fatalf("CheckMigrations: %v", err)
+	}
+	if status.Exists || len(status.Pending) != SchemaVersion {
+		t.Errorf("status = %+v, want a missing database with every step pending", status)
+	}
+	if _, err := os.Stat(dbPath(dataDir)); !os.IsNotExist(err) {
+		t.Error("CheckMigrations created the database")
+	}
+
+	result, err := Migrate(dataDir)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if result.To != SchemaVersion {
+		t.Errorf("migrated to v%d, want v%d", result.To, SchemaVersion)
+	}
+	if result.Backup != "" || len(backups(t, dataDir)) != 0 {
+		t.Error("backed up an empty database")
+	}
+}
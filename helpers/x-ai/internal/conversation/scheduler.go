@@ -0,0 +1,210 @@
+// Package conversation - Scheduler orders chat turns
+package conversation
+
+import (
+	"context"
+	"sync"
+)
+
+// Reasons a turn is waiting
+const (
+	QueueConversation = "conversation" // Another turn of the same conversation is running
+	QueueGlobal       = "global"       // Concurrent provider call limit reached
+)
+
+// QueueStatus describes where a waiting turn is
+type QueueStatus struct {
+	Position int    // 1 = next to run
+	Reason   string // QueueConversation or QueueGlobal
+}
+
+// Turn is a chat turn's place in its conversation queue
+type Turn struct {
+	scheduler      *Scheduler
+	conversationID string
+	ready          chan struct{} // Closed when the turn reaches the head
+	onQueued       func(QueueStatus)
+	slot           bool // Holds a global slot
+	once           sync.Once
+}
+
+// Scheduler runs chat turns one at a time per conversation, in arrival
+// order, and caps the number of provider calls running at once.
+type Scheduler struct {
+	queues map[string][]*Turn // Head of each queue is the running turn
+	mu     sync.Mutex
+
+	slots         chan struct{} // Global semaphore, nil = unlimited
+	globalWaiting int
+}
+
+// NewScheduler creates a scheduler allowing maxConcurrent turns at once
+// across all conversations (0 = unlimited)
+func NewScheduler(maxConcurrent int) *Scheduler {
+	s := &Scheduler{
+		queues: make(map[string][]*Turn),
+	}
+	if maxConcurrent > 0 {
+		s.slots = make(chan struct{}, maxConcurrent)
+	}
+	return s
+}
+
+// Reserve queues a turn for a conversation without blocking. Turns run in
+// the order they were reserved, so reserve as soon as a request arrives.
+// The turn must be released when done, whether or not it was waited for.
+func (s *Scheduler) Reserve(conversationID string) *Turn {
+	t := &Turn{
+		scheduler:      s,
+		conversationID: conversationID,
+		ready:          make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	queue := append(s.queues[conversationID], t)
+	s.queues[conversationID] = queue
+	if len(queue) == 1 {
+		close(t.ready)
+	}
+	s.mu.Unlock()
+
+	return t
+}
+
+// ConversationID returns the conversation the turn belongs to
+func (t *Turn) ConversationID() string {
+	return t.conversationID
+}
+
+// Wait blocks until it is this turn's go for the conversation and a
+// global slot is free. onQueued (optional) is called whenever the turn
+// has to wait or moves up in the queue.
+func (t *Turn) Wait(ctx context.Context, onQueued func(QueueStatus)) error {
+	if err := t.WaitInOrder(ctx, onQueued); err != nil {
+		return err
+	}
+
+	// Wait for a global slot
+	if err := t.scheduler.acquireSlot(ctx, onQueued); err != nil {
+		return err
+	}
+	t.slot = t.scheduler.slots != nil
+	return nil
+}
+
+// WaitInOrder blocks until the earlier turns of the conversation are done,
+// without taking a global slot. It suits requests that change the
+// conversation but do not call a provider.
+func (t *Turn) WaitInOrder(ctx context.Context, onQueued func(QueueStatus)) error {
+	s := t.scheduler
+
+	s.mu.Lock()
+	t.onQueued = onQueued
+	position := s.position(t)
+	s.mu.Unlock()
+
+	if position > 0 && onQueued != nil {
+		onQueued(QueueStatus{Position: position, Reason: QueueConversation})
+	}
+
+	// Wait for our turn in the conversation
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release gives up the turn, starting the next one. Safe to call more
+// than once.
+func (t *Turn) Release() {
+	t.once.Do(func() {
+		if t.slot {
+			<-t.scheduler.slots
+		}
+		t.scheduler.leave(t.conversationID, t)
+	})
+}
+
+// position returns the turn's index in its queue (0 = running).
+// Must be called with s.mu held.
+func (s *Scheduler) position(t *Turn) int {
+	for i, qt := range s.queues[t.conversationID] {
+		if qt == t {
+			return i
+		}
+	}
+	return 0
+}
+
+// acquireSlot takes a global slot, waiting if the limit is reached
+func (s *Scheduler) acquireSlot(ctx context.Context, onQueued func(QueueStatus)) error {
+	if s.slots == nil {
+		return nil
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	s.mu.Lock()
+	s.globalWaiting++
+	position := s.globalWaiting
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.globalWaiting--
+		s.mu.Unlock()
+	}()
+
+	if onQueued != nil {
+		onQueued(QueueStatus{Position: position, Reason: QueueGlobal})
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// leave removes a turn from its conversation queue, starting the next
+// turn if it was running and telling the others their new position
+func (s *Scheduler) leave(conversationID string, t *Turn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue := s.queues[conversationID]
+	idx := -1
+	for i, qt := range queue {
+		if qt == t {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return
+	}
+
+	queue = append(queue[:idx:idx], queue[idx+1:]...)
+	if len(queue) == 0 {
+		delete(s.queues, conversationID)
+		return
+	}
+	s.queues[conversationID] = queue
+
+	// Only the running turn leaving changes anyone's position at the head
+	if idx == 0 {
+		close(queue[0].ready)
+	}
+	for i := max(idx, 1); i < len(queue); i++ {
+		if queue[i].onQueued != nil {
+			queue[i].onQueued(QueueStatus{Position: i, Reason: QueueConversation})
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package conversation
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// started reports whether a turn's Wait returned within a short time
+func started(done <-chan error) bool {
+	select {
+	case <-done:
+		return true
+	case <-time.After(20 * time.Millisecond):
+		return false
+	}
+}
+
+// waitAsync waits for a turn in the background, recording queue updates
+func waitAsync(t *Turn, statuses *[]QueueStatus, mu *sync.Mutex) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- t.Wait(context.Background(), func(st QueueStatus) {
+			mu.Lock()
+			*statuses = append(*statuses, st)
+			mu.Unlock()
+		})
+	}()
+	return done
+}
+
+func TestSchedulerConversationOrder(t *testing.T) {
+	s := NewScheduler(0)
+	var mu sync.Mutex
+
+	turns := []*Turn{s.Reserve("a"), s.Reserve("a"), s.Reserve("a")}
+	other := s.Reserve("b")
+	statuses := make([][]QueueStatus, len(turns))
+
+	// Wait in reverse: order comes from Reserve, not from Wait
+	done := make([]<-chan error, len(turns))
+	for i := len(turns) - 1; i >= 0; i-- {
+		done[i] = waitAsync(turns[i], &statuses[i], &mu)
+	}
+
+	if !started(waitAsync(other, new([]QueueStatus), &mu)) {
+		t.Fatal("another conversation's turn waited")
+	}
+
+	for i := range turns {
+		if !started(done[i]) {
+			t.Fatalf("turn %d did not start", i)
+		}
+		for j := i + 1; j < len(turns); j++ {
+			if started(done[j]) {
+				t.Fatalf("turn %d started while turn %d runs", j, i)
+			}
+		}
+		turns[i].Release()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	tests := []struct {
+		turn int
+		want []int // Positions reported, in order
+	}{
+		{0, nil},
+		{1, []int{1}},
+		{2, []int{2, 1}},
+	}
+	for _, tt := range tests {
+		var got []int
+		for _, st := range statuses[tt.turn] {
+			if st.Reason != QueueConversation {
+				t.Errorf("turn %d: reason %q", tt.turn, st.Reason)
+			}
+			got = append(got, st.Position)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("turn %d: positions %v, want %v", tt.turn, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("turn %d: positions %v, want %v", tt.turn, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSchedulerGlobalLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		turns   int
+		running int // Started before any release
+	}{
+		{"unlimited", 0, 3, 3},
+		{"one at a time", 1, 3, 1},
+		{"two at a time", 2, 3, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(tt.limit)
+			var mu sync.Mutex
+			var statuses []QueueStatus
+
+			turns := make([]*Turn, tt.turns)
+			done := make([]<-chan error, tt.turns)
+			for i := range turns {
+				turns[i] = s.Reserve(string(rune('a' + i))) // One per conversation
+				done[i] = waitAsync(turns[i], &statuses, &mu)
+			}
+
+			var running, waiting []int
+			for i := range turns {
+				if started(done[i]) {
+					running = append(running, i)
+				} else {
+					waiting = append(waiting, i)
+				}
+			}
+			if len(running) != tt.running {
+				t.Fatalf("%d turns running, want %d", len(running), tt.running)
+			}
+
+			mu.Lock()
+			for _, st := range statuses {
+				if st.Reason != QueueGlobal {
+					t.Errorf("waiting for %q, want %q", st.Reason, QueueGlobal)
+				}
+			}
+			if len(statuses) != len(waiting) {
+				t.Errorf("%d queued notices for %d waiting turns", len(statuses), len(waiting))
+			}
+			mu.Unlock()
+
+			// Each release lets exactly one waiting turn in
+			for len(waiting) > 0 {
+				turns[running[0]].Release()
+				running = running[1:]
+
+				var still []int
+				for _, i := range waiting {
+					if started(done[i]) {
+						running = append(running, i)
+					} else {
+						still = append(still, i)
+					}
+				}
+				if len(waiting)-len(still) != 1 {
+					t.Fatalf("a release started %d turns, want 1", len(waiting)-len(still))
+				}
+				waiting = still
+			}
+			for _, i := range running {
+				turns[i].Release()
+			}
+		})
+	}
+}
+
+func TestTurnReleaseBeforeWait(t *testing.T) {
+	s := NewScheduler(1)
+	first, second := s.Reserve("a"), s.Reserve("a")
+
+	// A request rejected before its turn gives it up without waiting,
+	// twice to check Release is idempotent
+	first.Release()
+	first.Release()
+
+	if err := second.Wait(context.Background(), nil); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	second.Release()
+
+	// Both the slot and the queue are free again
+	third := s.Reserve("a")
+	if !started(waitAsync(third, new([]QueueStatus), new(sync.Mutex))) {
+		t.Fatal("turn waited on an empty scheduler")
+	}
+	third.Release()
+}
+
+func TestTurnWaitCancelled(t *testing.T) {
+	s := NewScheduler(0)
+	running, queued := s.Reserve("a"), s.Reserve("a")
+	behind := s.Reserve("a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- queued.Wait(ctx, nil) }()
+	cancel()
+	if err := <-done; err == nil {
+		t.Fatal("cancelled Wait returned nil")
+	}
+	queued.Release()
+
+	// The cancelled turn no longer holds up the one behind it
+	running.Release()
+	if !started(waitAsync(behind, new([]QueueStatus), new(sync.Mutex))) {
+		t.Fatal("turn behind a cancelled one did not start")
+	}
+	behind.Release()
+}
+
+func TestTurnWaitInOrderTakesNoSlot(t *testing.T) {
+	s := NewScheduler(1)
+	busy := s.Reserve("a")
+	if err := busy.Wait(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Release()
+
+	// The only slot is taken, but a branch switch elsewhere needs none
+	other := s.Reserve("b")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := other.WaitInOrder(ctx, nil); err != nil {
+		t.Fatalf("WaitInOrder: %v", err)
+	}
+	other.Release()
+}
@@ -0,0 +1,386 @@
+// Package conversation - full-text search over messages and titles
+package conversation
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Search limits and snippet formatting
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+
+	// Matched terms in snippets are wrapped in Markdown bold
+	HighlightStart = "**"
+	HighlightEnd   = "**"
+
+	snippetEllipsis = "…"
+	snippetTokens   = 16  // FTS5 snippet length in tokens
+	snippetRunes    = 120 // LIKE fallback snippet length
+)
+
+// SearchResult is one ranked match. MessageID is empty when only the
+// conversation title matched.
+type SearchResult struct {
+	ConversationID string    `json:"conversation_id"`
+	Title          string    `json:"title"`
+	MessageID      string    `json:"message_id,omitempty"`
+	Role           string    `json:"role,omitempty"`
+	Snippet        string    `json:"snippet"` // Matches wrapped in HighlightStart/End
+	Rank           float64   `json:"rank"`    // Lower is better
+	CreatedAt      time.Time `json:"created_at"`
+	Archived       bool      `json:"archived,omitempty"`
+}
+
+// searchSchema creates the FTS5 indexes. Both are external content
+// tables, so the text is stored only once.
+const searchSchema = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		content, content='messages', content_rowid='rowid',
+		tokenize='unicode61 remove_diacritics 2'
+	);
+	CREATE VIRTUAL TABLE IF NOT EXISTS conversations_fts USING fts5(
+		title, content='conversations', content_rowid='rowid',
+		tokenize='unicode61 remove_diacritics 2'
+	);
+`
+
+// searchTriggers keep the indexes in sync with their tables
+const searchTriggers = `
+	CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+		INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS conversations_fts_insert AFTER INSERT ON conversations BEGIN
+		INSERT INTO conversations_fts(rowid, title) VALUES (new.rowid, new.title);
+	END;
+	CREATE TRIGGER IF NOT EXISTS conversations_fts_delete AFTER DELETE ON conversations BEGIN
+		INSERT INTO conversations_fts(conversations_fts, rowid, title) VALUES ('delete', old.rowid, old.title);
+	END;
+	CREATE TRIGGER IF NOT EXISTS conversations_fts_update AFTER UPDATE OF title ON conversations BEGIN
+		INSERT INTO conversations_fts(conversations_fts, rowid, title) VALUES ('delete', old.rowid, old.title);
+		INSERT INTO conversations_fts(rowid, title) VALUES (new.rowid, new.title);
+	END;
+`
+
+// searchTriggerNames lists the triggers created by searchTriggers
+var searchTriggerNames = []string{
+	"messages_fts_insert", "messages_fts_delete", "messages_fts_update",
+	"conversations_fts_insert", "conversations_fts_delete", "conversations_fts_update",
+}
+
+// migrateSearch sets up the full-text indexes. Builds without FTS5
+// (missing the sqlite_fts5 tag) drop the sync triggers so that writes keep
+// working, and search falls back to LIKE; the index is rebuilt the next
+// time an FTS5 build opens the database.
+func (s *Store) migrateSearch() error {
+	if !s.fts5Available() {
+		log.Printf("SQLite built without FTS5, search uses LIKE (build with -tags sqlite_fts5)")
+		for _, name := range searchTriggerNames {
+			if _, err := s.db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return fmt.Errorf("drop search trigger: %w", err)
+			}
+		}
+		return nil
+	}
+
+	if _, err := s.db.Exec(searchSchema); err != nil {
+		return fmt.Errorf("create search index: %w", err)
+	}
+
+	synced, err := s.searchTriggersExist()
+	if err != nil {
+		return err
+	}
+
+	if !synced {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(searchTriggers); err != nil {
+			return fmt.Errorf("create search triggers: %w", err)
+		}
+		// Index everything written while the triggers were missing
+		if _, err := tx.Exec(`INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("rebuild message index: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO conversations_fts(conversations_fts) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("rebuild title index: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	s.fts = true
+	return nil
+}
+
+// detectSearch enables FTS5 search on a read-only store if the index
+// exists and is kept in sync
+func (s *Store) detectSearch() {
+	if !s.fts5Available() {
+		return
+	}
+	synced, err := s.searchTriggersExist()
+	s.fts = err == nil && synced
+}
+
+// searchTriggersExist reports whether all sync triggers are installed
+func (s *Store) searchTriggersExist() (bool, error) {
+	args := make([]interface{}, len(searchTriggerNames))
+	for i, name := range searchTriggerNames {
+		args[i] = name
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN (`+placeholders+`)
+	`, args...).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("check search triggers: %w", err)
+	}
+	return count == len(searchTriggerNames), nil
+}
+
+// fts5Available reports whether SQLite was compiled with FTS5
+func (s *Store) fts5Available() bool {
+	var enabled bool
+	err := s.db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+	return err == nil && enabled
+}
+
+// FullTextSearch reports whether search uses the FTS5 index
+func (s *Store) FullTextSearch() bool {
+	return s.fts
+}
+
+// Search finds messages and conversation titles matching every word of
+// query, best matches first
+func (s *Store) Search(query string, limit int, includeArchived bool) ([]*SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	if s.fts {
+		return s.searchFTS(terms, limit, includeArchived)
+	}
+	return s.searchLike(terms, limit, includeArchived)
+}
+
+// searchTerms splits a query into words
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' && r != '-' && r != '.'
+	})
+}
+
+// ftsQuery builds an FTS5 MATCH expression requiring every term. Terms
+// are quoted so user input is never parsed as query syntax; the last one
+// also matches as a prefix so results show up while typing.
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	quoted[len(quoted)-1] += "*"
+	return strings.Join(quoted, " ")
+}
+
+// searchFTS ranks matches with bm25. Title matches are weighted up so a
+// conversation named after the query comes before passing mentions.
+func (s *Store) searchFTS(terms []string, limit int, includeArchived bool) ([]*SearchResult, error) {
+	rows, err := s.db.Query(`
+		SELECT c.id, c.title, c.archived, m.id, m.role,
+			snippet(messages_fts, 0, ?, ?, ?, ?), bm25(messages_fts), m.created_at
+		FROM messages_fts
+		JOIN messages m ON m.rowid = messages_fts.rowid
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE messages_fts MATCH ? AND (c.archived = 0 OR ?)
+
+		UNION ALL
+
+		SELECT c.id, c.title, c.archived, '', '',
+			highlight(conversations_fts, 0, ?, ?), bm25(conversations_fts) * 2, c.updated_at
+		FROM conversations_fts
+		JOIN conversations c ON c.rowid = conversations_fts.rowid
+		WHERE conversations_fts MATCH ? AND (c.archived = 0 OR ?)
+
+		ORDER BY 7 ASC
+		LIMIT ?
+	`,
+		HighlightStart, HighlightEnd, snippetEllipsis, snippetTokens, ftsQuery(terms), includeArchived,
+		HighlightStart, HighlightEnd, ftsQuery(terms), includeArchived,
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	return scanSearchResults(rows)
+}
+
+// searchLike is the fallback for SQLite builds without FTS5. Matches are
+// case-insensitive for ASCII only and ordered newest first.
+func (s *Store) searchLike(terms []string, limit int, includeArchived bool) ([]*SearchResult, error) {
+	var msgWhere, titleWhere []string
+	var msgArgs, titleArgs []interface{}
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		msgWhere = append(msgWhere, `m.content LIKE ? ESCAPE '\'`)
+		titleWhere = append(titleWhere, `c.title LIKE ? ESCAPE '\'`)
+		msgArgs = append(msgArgs, pattern)
+		titleArgs = append(titleArgs, pattern)
+	}
+
+	args := append(msgArgs, includeArchived)
+	args = append(args, titleArgs...)
+	args = append(args, includeArchived, limit)
+
+	rows, err := s.db.Query(`
+		SELECT c.id, c.title, c.archived, m.id, m.role, m.content, 0, m.created_at
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE `+strings.Join(msgWhere, " AND ")+` AND (c.archived = 0 OR ?)
+
+		UNION ALL
+
+		SELECT c.id, c.title, c.archived, '', '', c.title, 0, c.updated_at
+		FROM conversations c
+		WHERE `+strings.Join(titleWhere, " AND ")+` AND (c.archived = 0 OR ?)
+
+		ORDER BY 8 DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+
+	results, err := scanSearchResults(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		r.Snippet = likeSnippet(r.Snippet, terms)
+	}
+	return results, nil
+}
+
+// scanSearchResults reads rows produced by searchFTS or searchLike
+func scanSearchResults(rows *sql.Rows) ([]*SearchResult, error) {
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		r := &SearchResult{}
+		var archived int
+		var createdAt int64
+
+		if err := rows.Scan(&r.ConversationID, &r.Title, &archived, &r.MessageID, &r.Role, &r.Snippet, &r.Rank, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan search result: %w", err)
+		}
+
+		r.Archived = archived != 0
+		r.CreatedAt = time.Unix(createdAt, 0)
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards in a search term
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+// likeSnippet cuts a window around the first match and highlights every
+// occurrence of the terms in it
+func likeSnippet(text string, terms []string) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	lower := lowerRunes(runes)
+
+	needles := make([][]rune, len(terms))
+	first := -1
+	for i, term := range terms {
+		needles[i] = lowerRunes([]rune(term))
+		if j := runeIndex(lower, needles[i]); j >= 0 && (first < 0 || j < first) {
+			first = j
+		}
+	}
+
+	start := max(first-snippetRunes/4, 0)
+	end := min(start+snippetRunes, len(runes))
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(snippetEllipsis)
+	}
+	for i := start; i < end; {
+		n := 0
+		for _, t := range needles {
+			if i+len(t) <= end && runeIndex(lower[i:i+len(t)], t) == 0 {
+				n = len(t)
+				break
+			}
+		}
+		if n == 0 {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		b.WriteString(HighlightStart)
+		b.WriteString(string(runes[i : i+n]))
+		b.WriteString(HighlightEnd)
+		i += n
+	}
+	if end < len(runes) {
+		b.WriteString(snippetEllipsis)
+	}
+	return b.String()
+}
+
+// lowerRunes lowercases rune by rune, keeping indexes aligned
+func lowerRunes(runes []rune) []rune {
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	return lower
+}
+
+// runeIndex returns the index of sub in s, or -1
+func runeIndex(s, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
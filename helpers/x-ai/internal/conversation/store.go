@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,36 +22,75 @@ type Conversation struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Archived  bool      `json:"archived"`
+	Pinned    bool      `json:"pinned"` // Listed before other conversations
+
+	// Last message of the branch being continued (empty until the first message)
+	ActiveLeaf string `json:"active_leaf,omitempty"`
+}
+
+// ArchiveFilter selects conversations by archived state
+type ArchiveFilter string
+
+// Archive filters
+const (
+	ArchivedExclude ArchiveFilter = "exclude" // Active conversations only (default)
+	ArchivedInclude ArchiveFilter = "include" // Active and archived
+	ArchivedOnly    ArchiveFilter = "only"    // Archived conversations only
+)
+
+// ParseArchiveFilter validates a filter name; empty means ArchivedExclude
+func ParseArchiveFilter(name string) (ArchiveFilter, error) {
+	switch filter := ArchiveFilter(name); filter {
+	case "":
+		return ArchivedExclude, nil
+	case ArchivedExclude, ArchivedInclude, ArchivedOnly:
+		return filter, nil
+	}
+	return "", fmt.Errorf("invalid archived filter %q (use exclude, include or only)", name)
 }
 
 // Message represents a single message in a conversation
 type Message struct {
 	ID             string    `json:"id"`
 	ConversationID string    `json:"conversation_id"`
-	Role           string    `json:"role"` // "system", "user", "assistant"
+	ParentID       string    `json:"parent_id,omitempty"` // Previous message on its branch
+	Role           string    `json:"role"`                // "system", "user", "assistant"
 	Content        string    `json:"content"`
 	TokenCount     int       `json:"token_count,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
+
+	// Messages sharing this one's parent, itself included, and its
+	// 1-based position among them (oldest first). Set on loaded paths.
+	SiblingCount int `json:"sibling_count,omitempty"`
+	SiblingIndex int `json:"sibling_index,omitempty"`
+
+	Attachments []*Attachment `json:"attachments,omitempty"`
 }
 
 // Store handles conversation persistence in SQLite
 type Store struct {
 	db      *sql.DB
 	dataDir string
+	fts     bool // Full-text index available (see migrateSearch)
 }
 
-// NewStore creates a new conversation store
+// NewStore creates a new conversation store, migrating the schema
 func NewStore(dataDir string) (*Store, error) {
+	store, _, err := openStore(dataDir)
+	return store, err
+}
+
+// openStore opens (or creates) the database and applies migrations
+func openStore(dataDir string) (*Store, *MigrationResult, error) {
 	// Ensure directory exists
 	dbDir := filepath.Join(dataDir, "db")
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		return nil, fmt.Errorf("create db dir: %w", err)
+		return nil, nil, fmt.Errorf("create db dir: %w", err)
 	}
 
-	dbPath := filepath.Join(dbDir, "conversations.db")
-	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	db, err := sql.Open("sqlite3", dbPath(dataDir)+"?_journal_mode=WAL&_busy_timeout=5000")
 	if err != nil {
-		return nil, fmt.Errorf("open database: %w", err)
+		return nil, nil, fmt.Errorf("open database: %w", err)
 	}
 
 	store := &Store{
@@ -58,44 +98,62 @@ func NewStore(dataDir string) (*Store, error) {
 		dataDir: dataDir,
 	}
 
-	if err := store.migrate(); err != nil {
+	result, err := store.migrate()
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	return store, result, nil
+}
+
+// OpenReadOnly opens an existing conversation database without
+// modifying it (no schema changes), for inspection while the daemon
+// is not running
+func OpenReadOnly(dataDir string) (*Store, error) {
+	path := dbPath(dataDir)
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	// Without migrations, queries need the current schema
+	version, err := schemaVersion(db)
+	if err == nil && version != SchemaVersion {
+		err = fmt.Errorf("database schema is v%d, this build needs v%d (run x-ai db migrate)", version, SchemaVersion)
+	}
+	if err != nil {
 		db.Close()
-		return nil, fmt.Errorf("migrate: %w", err)
+		return nil, err
 	}
 
+	store := &Store{
+		db:      db,
+		dataDir: dataDir,
+	}
+	store.detectSearch()
 	return store, nil
 }
 
-// migrate creates the database schema
-func (s *Store) migrate() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS conversations (
-		id TEXT PRIMARY KEY,
-		title TEXT NOT NULL,
-		provider TEXT NOT NULL,
-		model TEXT NOT NULL,
-		created_at INTEGER NOT NULL,
-		updated_at INTEGER NOT NULL,
-		archived INTEGER DEFAULT 0
-	);
-
-	CREATE TABLE IF NOT EXISTS messages (
-		id TEXT PRIMARY KEY,
-		conversation_id TEXT NOT NULL,
-		role TEXT NOT NULL,
-		content TEXT NOT NULL,
-		token_count INTEGER DEFAULT 0,
-		created_at INTEGER NOT NULL,
-		FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_messages_conv ON messages(conversation_id);
-	CREATE INDEX IF NOT EXISTS idx_messages_created ON messages(created_at);
-	CREATE INDEX IF NOT EXISTS idx_conversations_updated ON conversations(updated_at DESC);
-	`
+// DiskSize returns the size of the database files in bytes
+func (s *Store) DiskSize() int64 {
+	path := dbPath(s.dataDir)
 
-	_, err := s.db.Exec(schema)
-	return err
+	var total int64
+	for _, path := range []string{path, path + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
 }
 
 // Close closes the database connection
@@ -105,9 +163,14 @@ func (s *Store) Close() error {
 
 // CreateConversation creates a new conversation
 func (s *Store) CreateConversation(provider, model, title string) (*Conversation, error) {
+	return s.CreateConversationWithID(uuid.New().String(), provider, model, title)
+}
+
+// CreateConversationWithID creates a conversation with a pre-generated ID
+func (s *Store) CreateConversationWithID(id, provider, model, title string) (*Conversation, error) {
 	now := time.Now()
 	conv := &Conversation{
-		ID:        uuid.New().String(),
+		ID:        id,
 		Title:     title,
 		Provider:  provider,
 		Model:     model,
@@ -131,15 +194,15 @@ func (s *Store) CreateConversation(provider, model, title string) (*Conversation
 // GetConversation retrieves a conversation by ID
 func (s *Store) GetConversation(id string) (*Conversation, error) {
 	row := s.db.QueryRow(`
-		SELECT id, title, provider, model, created_at, updated_at, archived
+		SELECT id, title, provider, model, created_at, updated_at, archived, pinned, COALESCE(active_leaf, '')
 		FROM conversations WHERE id = ?
 	`, id)
 
 	conv := &Conversation{}
 	var createdAt, updatedAt int64
-	var archived int
+	var archived, pinned int
 
-	err := row.Scan(&conv.ID, &conv.Title, &conv.Provider, &conv.Model, &createdAt, &updatedAt, &archived)
+	err := row.Scan(&conv.ID, &conv.Title, &conv.Provider, &conv.Model, &createdAt, &updatedAt, &archived, &pinned, &conv.ActiveLeaf)
 	if err == sql.ErrNoRows {
 		return nil, nil // Not found
 	}
@@ -150,26 +213,31 @@ func (s *Store) GetConversation(id string) (*Conversation, error) {
 	conv.CreatedAt = time.Unix(createdAt, 0)
 	conv.UpdatedAt = time.Unix(updatedAt, 0)
 	conv.Archived = archived != 0
+	conv.Pinned = pinned != 0
 
 	return conv, nil
 }
 
-// ListConversations returns all conversations, newest first
-func (s *Store) ListConversations(limit int, includeArchived bool) ([]*Conversation, error) {
+// ListConversations returns conversations matching filter, pinned
+// first, then newest first
+func (s *Store) ListConversations(limit int, filter ArchiveFilter) ([]*Conversation, error) {
+	where := "archived = 0"
+	switch filter {
+	case ArchivedInclude:
+		where = "1"
+	case ArchivedOnly:
+		where = "archived != 0"
+	}
+
 	query := `
-		SELECT id, title, provider, model, created_at, updated_at, archived
+		SELECT id, title, provider, model, created_at, updated_at, archived, pinned
 		FROM conversations
-		WHERE archived = 0 OR archived = ?
-		ORDER BY updated_at DESC
+		WHERE ` + where + `
+		ORDER BY pinned DESC, updated_at DESC
 		LIMIT ?
 	`
 
-	archivedFilter := 0
-	if includeArchived {
-		archivedFilter = 1
-	}
-
-	rows, err := s.db.Query(query, archivedFilter, limit)
+	rows, err := s.db.Query(query, limit)
 	if err != nil {
 		return nil, fmt.Errorf("query conversations: %w", err)
 	}
@@ -179,15 +247,16 @@ func (s *Store) ListConversations(limit int, includeArchived bool) ([]*Conversat
 	for rows.Next() {
 		conv := &Conversation{}
 		var createdAt, updatedAt int64
-		var archived int
+		var archived, pinned int
 
-		if err := rows.Scan(&conv.ID, &conv.Title, &conv.Provider, &conv.Model, &createdAt, &updatedAt, &archived); err != nil {
+		if err := rows.Scan(&conv.ID, &conv.Title, &conv.Provider, &conv.Model, &createdAt, &updatedAt, &archived, &pinned); err != nil {
 			return nil, fmt.Errorf("scan conversation: %w", err)
 		}
 
 		conv.CreatedAt = time.Unix(createdAt, 0)
 		conv.UpdatedAt = time.Unix(updatedAt, 0)
 		conv.Archived = archived != 0
+		conv.Pinned = pinned != 0
 		convs = append(convs, conv)
 	}
 
@@ -212,9 +281,29 @@ func (s *Store) UpdateConversationTime(id string) error {
 
 // ArchiveConversation archives a conversation
 func (s *Store) ArchiveConversation(id string) error {
+	return s.SetConversationArchived(id, true)
+}
+
+// SetConversationArchived archives or restores a conversation
+func (s *Store) SetConversationArchived(id string, archived bool) error {
+	value := 0
+	if archived {
+		value = 1
+	}
 	_, err := s.db.Exec(`
-		UPDATE conversations SET archived = 1, updated_at = ? WHERE id = ?
-	`, time.Now().Unix(), id)
+		UPDATE conversations SET archived = ?, updated_at = ? WHERE id = ?
+	`, value, time.Now().Unix(), id)
+	return err
+}
+
+// SetConversationPinned pins or unpins a conversation. Pinning does not
+// touch updated_at, so unpinned chats return to their place in the list.
+func (s *Store) SetConversationPinned(id string, pinned bool) error {
+	value := 0
+	if pinned {
+		value = 1
+	}
+	_, err := s.db.Exec(`UPDATE conversations SET pinned = ? WHERE id = ?`, value, id)
 	return err
 }
 
@@ -226,7 +315,12 @@ func (s *Store) DeleteConversation(id string) error {
 	}
 	defer tx.Rollback()
 
-	// Delete messages first (foreign key constraint)
+	// Delete attachments and messages first (foreign key constraint)
+	if _, err := tx.Exec(`
+		DELETE FROM attachments WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)
+	`, id); err != nil {
+		return fmt.Errorf("delete attachments: %w", err)
+	}
 	if _, err := tx.Exec("DELETE FROM messages WHERE conversation_id = ?", id); err != nil {
 		return fmt.Errorf("delete messages: %w", err)
 	}
@@ -239,77 +333,209 @@ func (s *Store) DeleteConversation(id string) error {
 	return tx.Commit()
 }
 
-// AddMessage adds a message to a conversation
-func (s *Store) AddMessage(conversationID, role, content string, tokenCount int) (*Message, error) {
-	return s.AddMessageWithID(conversationID, uuid.New().String(), role, content, tokenCount)
+// AddMessage adds a message after parentID (empty for the first
+// message) and makes it the conversation's active leaf
+func (s *Store) AddMessage(conversationID, parentID, role, content string, tokenCount int) (*Message, error) {
+	return s.AddMessageWithID(conversationID, uuid.New().String(), parentID, role, content, tokenCount)
 }
 
 // AddMessageWithID adds a message with a pre-generated ID (for streaming)
-func (s *Store) AddMessageWithID(conversationID, id, role, content string, tokenCount int) (*Message, error) {
+func (s *Store) AddMessageWithID(conversationID, id, parentID, role, content string, tokenCount int) (*Message, error) {
 	now := time.Now()
 	msg := &Message{
 		ID:             id,
 		ConversationID: conversationID,
+		ParentID:       parentID,
 		Role:           role,
 		Content:        content,
 		TokenCount:     tokenCount,
 		CreatedAt:      now,
 	}
 
-	_, err := s.db.Exec(`
-		INSERT INTO messages (id, conversation_id, role, content, token_count, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, msg.ID, msg.ConversationID, msg.Role, msg.Content, msg.TokenCount, now.Unix())
-
+	tx, err := s.db.Begin()
 	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO messages (id, conversation_id, parent_id, role, content, token_count, created_at)
+		VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?)
+	`, msg.ID, msg.ConversationID, msg.ParentID, msg.Role, msg.Content, msg.TokenCount, now.Unix()); err != nil {
 		return nil, fmt.Errorf("insert message: %w", err)
 	}
 
-	// Update conversation timestamp
-	s.UpdateConversationTime(conversationID)
+	// Continue the conversation from the new message
+	if _, err := tx.Exec(`
+		UPDATE conversations SET active_leaf = ?, updated_at = ? WHERE id = ?
+	`, msg.ID, now.Unix(), conversationID); err != nil {
+		return nil, fmt.Errorf("update conversation: %w", err)
+	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("insert message: %w", err)
+	}
 	return msg, nil
 }
 
-// GetMessages retrieves all messages for a conversation
-func (s *Store) GetMessages(conversationID string) ([]*Message, error) {
+// DeleteMessage deletes a single message and its attachments. Replies to
+// it move up to its parent, as does the active leaf if it pointed here.
+func (s *Store) DeleteMessage(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE messages SET parent_id = (SELECT parent_id FROM messages WHERE id = ?) WHERE parent_id = ?
+	`, id, id); err != nil {
+		return fmt.Errorf("reparent replies: %w", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE conversations SET active_leaf = (SELECT parent_id FROM messages WHERE id = ?) WHERE active_leaf = ?
+	`, id, id); err != nil {
+		return fmt.Errorf("move active leaf: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM attachments WHERE message_id = ?", id); err != nil {
+		return fmt.Errorf("delete attachments: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM messages WHERE id = ?", id); err != nil {
+		return fmt.Errorf("delete message: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// AddAttachments stores attachments for a message
+func (s *Store) AddAttachments(messageID string, attachments []*Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, att := range attachments {
+		att.ID = uuid.New().String()
+		att.MessageID = messageID
+		att.CreatedAt = now
+
+		if _, err := tx.Exec(`
+			INSERT INTO attachments (id, message_id, name, path, mime_type, size, content, data, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, att.ID, att.MessageID, att.Name, att.Path, att.MimeType, att.Size, att.Content, att.Data, now.Unix()); err != nil {
+			return fmt.Errorf("insert attachment: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// loadAttachments fills in the attachments of the given messages
+func (s *Store) loadAttachments(messages []*Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*Message, len(messages))
+	args := make([]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		byID[msg.ID] = msg
+		args = append(args, msg.ID)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
 	rows, err := s.db.Query(`
-		SELECT id, conversation_id, role, content, token_count, created_at
-		FROM messages
-		WHERE conversation_id = ?
-		ORDER BY created_at ASC
-	`, conversationID)
+		SELECT id, message_id, name, path, mime_type, size, content, data, created_at
+		FROM attachments
+		WHERE message_id IN (`+placeholders+`)
+		ORDER BY created_at ASC, rowid ASC
+	`, args...)
 	if err != nil {
-		return nil, fmt.Errorf("query messages: %w", err)
+		return fmt.Errorf("query attachments: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []*Message
 	for rows.Next() {
-		msg := &Message{}
+		att := &Attachment{}
 		var createdAt int64
 
-		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.Role, &msg.Content, &msg.TokenCount, &createdAt); err != nil {
-			return nil, fmt.Errorf("scan message: %w", err)
+		if err := rows.Scan(&att.ID, &att.MessageID, &att.Name, &att.Path, &att.MimeType, &att.Size, &att.Content, &att.Data, &createdAt); err != nil {
+			return fmt.Errorf("scan attachment: %w", err)
 		}
 
-		msg.CreatedAt = time.Unix(createdAt, 0)
-		messages = append(messages, msg)
+		att.CreatedAt = time.Unix(createdAt, 0)
+		if msg := byID[att.MessageID]; msg != nil {
+			msg.Attachments = append(msg.Attachments, att)
+		}
 	}
 
-	return messages, rows.Err()
+	return rows.Err()
 }
 
-// GetRecentMessages retrieves the last N messages
-func (s *Store) GetRecentMessages(conversationID string, limit int) ([]*Message, error) {
-	// Get in reverse order then reverse
+// GetMessage retrieves a message with its attachments (nil if not found)
+func (s *Store) GetMessage(id string) (*Message, error) {
+	msg := &Message{}
+	var createdAt int64
+
+	err := s.db.QueryRow(`
+		SELECT id, conversation_id, COALESCE(parent_id, ''), role, content, token_count, created_at
+		FROM messages WHERE id = ?
+	`, id).Scan(&msg.ID, &msg.ConversationID, &msg.ParentID, &msg.Role, &msg.Content, &msg.TokenCount, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan message: %w", err)
+	}
+	msg.CreatedAt = time.Unix(createdAt, 0)
+
+	if err := s.loadAttachments([]*Message{msg}); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// GetActivePath retrieves the messages of a conversation's active branch
+func (s *Store) GetActivePath(conversationID string) ([]*Message, error) {
+	var leaf string
+	err := s.db.QueryRow(`
+		SELECT COALESCE(active_leaf, '') FROM conversations WHERE id = ?
+	`, conversationID).Scan(&leaf)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("query active leaf: %w", err)
+	}
+	if leaf == "" {
+		return nil, nil
+	}
+	return s.GetPath(leaf)
+}
+
+// GetPath retrieves the messages from the first one down to leafID,
+// following parent links, with their sibling counts
+func (s *Store) GetPath(leafID string) ([]*Message, error) {
 	rows, err := s.db.Query(`
-		SELECT id, conversation_id, role, content, token_count, created_at
-		FROM messages
-		WHERE conversation_id = ?
-		ORDER BY created_at DESC
-		LIMIT ?
-	`, conversationID, limit)
+		WITH RECURSIVE path(id, depth) AS (
+			SELECT id, 0 FROM messages WHERE id = ?
+			UNION ALL
+			SELECT m.parent_id, path.depth + 1
+			FROM messages m JOIN path ON m.id = path.id
+			WHERE m.parent_id IS NOT NULL
+		)
+		SELECT m.id, m.conversation_id, COALESCE(m.parent_id, ''), m.role, m.content, m.token_count, m.created_at,
+			(SELECT COUNT(*) FROM messages s
+			 WHERE s.conversation_id = m.conversation_id AND s.parent_id IS m.parent_id),
+			(SELECT COUNT(*) FROM messages s
+			 WHERE s.conversation_id = m.conversation_id AND s.parent_id IS m.parent_id
+			   AND (s.created_at < m.created_at OR (s.created_at = m.created_at AND s.rowid <= m.rowid)))
+		FROM path JOIN messages m ON m.id = path.id
+		ORDER BY path.depth DESC
+	`, leafID)
 	if err != nil {
 		return nil, fmt.Errorf("query messages: %w", err)
 	}
@@ -320,7 +546,8 @@ func (s *Store) GetRecentMessages(conversationID string, limit int) ([]*Message,
 		msg := &Message{}
 		var createdAt int64
 
-		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.Role, &msg.Content, &msg.TokenCount, &createdAt); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.ParentID, &msg.Role, &msg.Content, &msg.TokenCount, &createdAt,
+			&msg.SiblingCount, &msg.SiblingIndex); err != nil {
 			return nil, fmt.Errorf("scan message: %w", err)
 		}
 
@@ -332,14 +559,82 @@ func (s *Store) GetRecentMessages(conversationID string, limit int) ([]*Message,
 		return nil, err
 	}
 
-	// Reverse to get chronological order
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	if err := s.loadAttachments(messages); err != nil {
+		return nil, err
 	}
 
 	return messages, nil
 }
 
+// LatestLeaf follows the newest reply from a message down to the end of
+// its branch
+func (s *Store) LatestLeaf(messageID string) (string, error) {
+	var leaf string
+	err := s.db.QueryRow(`
+		WITH RECURSIVE branch(id, depth) AS (
+			SELECT ?, 0
+			UNION ALL
+			SELECT (SELECT c.id FROM messages c WHERE c.parent_id = branch.id
+			        ORDER BY c.created_at DESC, c.rowid DESC LIMIT 1), depth + 1
+			FROM branch WHERE branch.id IS NOT NULL
+		)
+		SELECT id FROM branch WHERE id IS NOT NULL ORDER BY depth DESC LIMIT 1
+	`, messageID).Scan(&leaf)
+	if err != nil {
+		return "", fmt.Errorf("find branch end: %w", err)
+	}
+	return leaf, nil
+}
+
+// SiblingAt returns the n-th (1-based, oldest first) message sharing
+// messageID's parent
+func (s *Store) SiblingAt(messageID string, n int) (string, error) {
+	var id string
+	err := s.db.QueryRow(`
+		SELECT s.id FROM messages s JOIN messages m ON s.conversation_id = m.conversation_id
+		WHERE m.id = ? AND s.parent_id IS m.parent_id
+		ORDER BY s.created_at ASC, s.rowid ASC
+		LIMIT 1 OFFSET ?
+	`, messageID, n-1).Scan(&id)
+	if err == sql.ErrNoRows || n < 1 {
+		return "", fmt.Errorf("version %d of message %s not found", n, messageID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("query siblings: %w", err)
+	}
+	return id, nil
+}
+
+// siblingPosition fills in msg's SiblingIndex and SiblingCount
+func (s *Store) siblingPosition(msg *Message) error {
+	err := s.db.QueryRow(`
+		SELECT
+			COUNT(*),
+			SUM(s.created_at < m.created_at OR (s.created_at = m.created_at AND s.rowid <= m.rowid))
+		FROM messages s JOIN messages m ON s.conversation_id = m.conversation_id
+		WHERE m.id = ? AND s.parent_id IS m.parent_id
+	`, msg.ID).Scan(&msg.SiblingCount, &msg.SiblingIndex)
+	if err != nil {
+		return fmt.Errorf("query siblings: %w", err)
+	}
+	return nil
+}
+
+// SetActiveLeaf switches a conversation to the branch ending at messageID
+func (s *Store) SetActiveLeaf(conversationID, messageID string) error {
+	res, err := s.db.Exec(`
+		UPDATE conversations SET active_leaf = ?
+		WHERE id = ? AND EXISTS (SELECT 1 FROM messages WHERE id = ? AND conversation_id = ?)
+	`, messageID, conversationID, messageID, conversationID)
+	if err != nil {
+		return fmt.Errorf("set active leaf: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("message %s not found in conversation %s", messageID, conversationID)
+	}
+	return nil
+}
+
 // CountMessages returns the number of messages in a conversation
 func (s *Store) CountMessages(conversationID string) (int, error) {
 	var count int
@@ -0,0 +1,66 @@
+// Package conversation - token estimates and the history budget
+package conversation
+
+import "unicode"
+
+// Estimation constants
+const (
+	imageTokens     = 765 // A high-detail image (OpenAI bills ~1024px as 4 tiles + base)
+	messageOverhead = 4   // Role and separators around each message
+)
+
+// EstimateTokens approximates the token count of text. BPE tokenizers
+// fit about four ASCII characters in a token but only one or two of other
+// alphabets, while CJK characters usually take a token each.
+func EstimateTokens(text string) int {
+	var ascii, narrow, wide int
+	for _, r := range text {
+		switch {
+		case r < 0x80:
+			ascii++
+		case isWide(r):
+			wide++
+		default:
+			narrow++
+		}
+	}
+	return (ascii+3)/4 + (narrow+1)/2 + wide
+}
+
+// isWide reports whether r typically costs a whole token
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		r >= 0x1F000 // Emoji and pictographs
+}
+
+// messageTokens estimates what a message costs in the prompt
+func messageTokens(msg *Message) int {
+	tokens := messageOverhead + EstimateTokens(promptContent(msg))
+	for _, att := range msg.Attachments {
+		if att.IsImage() {
+			tokens += imageTokens
+		}
+	}
+	return tokens
+}
+
+// fitHistory returns the longest tail of history that fits in budget
+// tokens. The last message, the turn being answered, is always kept,
+// and the tail never starts with an assistant reply.
+func fitHistory(history []*Message, budget int) []*Message {
+	start := len(history) - 1
+	used := messageTokens(history[start])
+	for start > 0 {
+		cost := messageTokens(history[start-1])
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+
+	for start < len(history)-1 && history[start].Role != "user" {
+		start++
+	}
+	return history[start:]
+}
@@ -0,0 +1,104 @@
+package conversation
+
+import (
+	"strings"
+	"testing"
+
+	"x-ai/internal/providers"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ascii rounds up", "hello", 2},
+		{"ascii", strings.Repeat("abcd", 10), 10},
+		{"cyrillic", "привет", 3},
+		{"accented", "é", 1},
+		{"cjk", "日本語です", 5},
+		{"hangul", "안녕", 2},
+		{"emoji", "🙂🙂", 2},
+		{"mixed", "hi 日本 привет", 1 + 2 + 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateTokens(tt.text); got != tt.want {
+				t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// costly returns a message of role costing tokens in the prompt
+func costly(role string, tokens int) *Message {
+	return &Message{Role: role, Content: strings.Repeat("abcd", tokens-messageOverhead)}
+}
+
+func TestFitHistory(t *testing.T) {
+	// Ten tokens per message, alternating from a user message
+	var history []*Message
+	for i := 0; i < 5; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		history = append(history, costly(role, 10))
+	}
+
+	tests := []struct {
+		name    string
+		history []*Message
+		budget  int
+		start   int // Index of the first message kept
+	}{
+		{"everything fits", history, 1000, 0},
+		{"exact fit", history, 50, 0},
+		{"oldest dropped", history, 30, 2},
+		{"no leading reply", history, 20, 4},
+		{"no budget keeps the last", history, 0, 4},
+		{"oversized last message", []*Message{costly("user", 10), costly("user", 500)}, 100, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fitHistory(tt.history, tt.budget)
+			want := tt.history[tt.start:]
+			if len(got) != len(want) || got[0] != want[0] {
+				t.Fatalf("kept %d messages, want the last %d", len(got), len(want))
+			}
+			if got[0].Role != "user" {
+				t.Errorf("history starts with %s", got[0].Role)
+			}
+		})
+	}
+}
+
+func TestHistoryBudget(t *testing.T) {
+	m := &Manager{
+		contextLimits: map[string]int{"tiny": 100, "big": 100000},
+		systemPrompt:  strings.Repeat("abcd", 25),
+	}
+	provider := &fakeProvider{}
+	reserved := messageOverhead + 25 + providers.MaxOutputTokens(provider)
+
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"big", 100000 - reserved},
+		{"tiny", 0}, // Clamped, not negative
+		{"unknown-model", providers.ContextWindow("unknown-model") - reserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := m.historyBudget(provider, tt.model); got != tt.want {
+				t.Errorf("historyBudget(%s) = %d, want %d", tt.model, got, tt.want)
+			}
+		})
+	}
+}
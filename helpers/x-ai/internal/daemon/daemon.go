@@ -13,9 +13,12 @@ import (
 	"sync"
 	"syscall"
 	"time"
+
+	"x-ai/internal/ipc"
 )
 
-// Config holds daemon configuration
+// Config holds daemon configuration. In the config file, durations are
+// strings such as "30s" or "15m" (see duration).
 type Config struct {
 	// Socket path for IPC
 	SocketPath string `json:"socket_path"`
@@ -29,11 +32,37 @@ type Config struct {
 	// Heartbeat interval for keep-alive
 	HeartbeatInterval time.Duration `json:"heartbeat_interval"`
 
+	// Clients that miss this many heartbeats in a row are disconnected
+	// (0 = never)
+	HeartbeatMisses int `json:"heartbeat_misses"`
+
+	// Max chat turns calling a provider at once (0 = unlimited)
+	MaxConcurrent int `json:"max_concurrent"`
+
+	// Context window in tokens per exact model name, overriding the
+	// built-in table (e.g. for Ollama models run with a larger num_ctx)
+	ContextLimits map[string]int `json:"context_limits,omitempty"`
+
 	// OpenAI configuration
 	OpenAI OpenAIConfig `json:"openai"`
 
 	// Ollama configuration (for future local mode)
 	Ollama OllamaConfig `json:"ollama"`
+
+	// Optional loopback HTTP gateway
+	HTTP HTTPConfig `json:"http"`
+}
+
+// HTTPConfig holds settings for the local HTTP + SSE gateway
+type HTTPConfig struct {
+	// Enable the gateway (off by default)
+	Enabled bool `json:"enabled"`
+
+	// Loopback address to listen on
+	Addr string `json:"addr"`
+
+	// File holding the bearer token (mode 0600)
+	TokenFile string `json:"token_file"`
 }
 
 // OpenAIConfig holds OpenAI-specific settings
@@ -72,10 +101,12 @@ func DefaultConfig() *Config {
 	dataDir := filepath.Join(homeDir, ".local", "share", "x-ai")
 
 	return &Config{
-		SocketPath:        "/tmp/x-ai.sock",
+		SocketPath:        DefaultSocketPath(),
 		DataDir:           dataDir,
 		IdleTimeout:       30 * time.Minute,
 		HeartbeatInterval: 15 * time.Second,
+		HeartbeatMisses:   3,
+		MaxConcurrent:     2,
 		OpenAI: OpenAIConfig{
 			APIKey:    os.Getenv("OPENAI_API_KEY"),
 			Model:     "gpt-4o-mini", // Cost-effective default
@@ -87,7 +118,33 @@ func DefaultConfig() *Config {
 			Model:    "llama3.2:3b",
 			Timeout:  120 * time.Second,
 		},
+		HTTP: HTTPConfig{
+			Addr:      "127.0.0.1:8765",
+			TokenFile: filepath.Join(dataDir, "http.token"),
+		},
+	}
+}
+
+// DefaultSocketPath returns the socket path in the user's runtime
+// directory, falling back to a per-user directory under /tmp
+func DefaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "x-ai", "x-ai.sock")
 	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("x-ai-%d", os.Getuid()), "x-ai.sock")
+}
+
+// ConfigPath returns the config file: $X_AI_CONFIG, or x-ai/config.json
+// in the user's config directory
+func ConfigPath() string {
+	if path := os.Getenv("X_AI_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "x-ai", "config.json")
 }
 
 // LoadConfig loads configuration from file, falling back to defaults
@@ -118,19 +175,55 @@ func LoadConfig(path string) (*Config, error) {
 	}
 	if dataDir := os.Getenv("X_AI_DATA_DIR"); dataDir != "" {
 		cfg.DataDir = dataDir
+		cfg.HTTP.TokenFile = filepath.Join(dataDir, "http.token")
+	}
+	if addr := os.Getenv("X_AI_HTTP_ADDR"); addr != "" {
+		cfg.HTTP.Enabled = true
+		cfg.HTTP.Addr = addr
 	}
 
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
 	return cfg, nil
 }
 
+// validate rejects settings that would silently misbehave
+func (c *Config) validate() error {
+	if c.IdleTimeout <= 0 {
+		return fmt.Errorf("idle_timeout must be positive, e.g. \"30m\"")
+	}
+	if c.HeartbeatInterval <= 0 {
+		return fmt.Errorf("heartbeat_interval must be positive, e.g. \"15s\"")
+	}
+	if c.OpenAI.Timeout < 0 || c.Ollama.Timeout < 0 {
+		return fmt.Errorf("provider timeout must not be negative")
+	}
+	if c.HeartbeatMisses < 0 {
+		return fmt.Errorf("heartbeat_misses must not be negative")
+	}
+	if c.MaxConcurrent < 0 {
+		return fmt.Errorf("max_concurrent must not be negative")
+	}
+	for model, tokens := range c.ContextLimits {
+		if tokens <= 0 {
+			return fmt.Errorf("context_limits: %s must be a positive token count", model)
+		}
+	}
+	return nil
+}
+
 // Daemon is the main x-ai daemon
 type Daemon struct {
 	cfg    *Config
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	// IPC server (will be added)
-	// ipc *ipc.Server
+	// IPC server for heartbeats and activity
+	ipc *ipc.Server
+
+	// In-flight requests (no idle shutdown while any are running)
+	requests *RequestTracker
 
 	// Providers (will be added)
 	// openai *providers.OpenAIProvider
@@ -138,6 +231,9 @@ type Daemon struct {
 	// Conversation manager (will be added)
 	// convMgr *conversation.Manager
 
+	// Start time for uptime reporting
+	started time.Time
+
 	// Activity tracking for idle timeout
 	lastActivity time.Time
 	activityMu   sync.Mutex
@@ -159,12 +255,17 @@ func New(cfg *Config) (*Daemon, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Daemon{
+	d := &Daemon{
 		cfg:          cfg,
 		ctx:          ctx,
 		cancel:       cancel,
+		requests:     NewRequestTracker(),
+		started:      time.Now(),
 		lastActivity: time.Now(),
-	}, nil
+	}
+	d.requests.onDone = d.RecordActivity
+
+	return d, nil
 }
 
 // Run starts the daemon and blocks until shutdown
@@ -187,7 +288,7 @@ func (d *Daemon) Run() error {
 	d.wg.Add(1)
 	go d.idleWatcher()
 
-	// Start heartbeat (placeholder - will send to IPC clients)
+	// Start heartbeat to IPC clients
 	d.wg.Add(1)
 	go d.heartbeat()
 
@@ -230,6 +331,12 @@ func (d *Daemon) idleWatcher() {
 		case <-d.ctx.Done():
 			return
 		case <-ticker.C:
+			// Streams in flight or subscribed clients keep the daemon alive
+			if d.busy() {
+				d.RecordActivity()
+				continue
+			}
+
 			d.activityMu.Lock()
 			idle := time.Since(d.lastActivity)
 			d.activityMu.Unlock()
@@ -255,12 +362,50 @@ func (d *Daemon) heartbeat() {
 		case <-d.ctx.Done():
 			return
 		case <-ticker.C:
-			// TODO: Send heartbeat to IPC clients
-			// d.ipc.Broadcast(HeartbeatMessage{...})
+			if d.ipc != nil {
+				d.ipc.Heartbeat(d.cfg.HeartbeatMisses)
+			}
 		}
 	}
 }
 
+// busy reports whether work is in progress that must not be interrupted
+func (d *Daemon) busy() bool {
+	if d.requests.Count() > 0 {
+		return true
+	}
+	return d.ipc != nil && d.ipc.SubscriptionCount() > 0
+}
+
+// AttachIPC sets the IPC server that receives heartbeats and
+// reports client activity. Must be called before the server is
+// started and before Run.
+func (d *Daemon) AttachIPC(s *ipc.Server) {
+	d.ipc = s
+	s.OnActivity(d.RecordActivity)
+}
+
+// Requests returns the tracker for in-flight requests
+func (d *Daemon) Requests() *RequestTracker {
+	return d.requests
+}
+
+// IdleRemaining returns how long until the idle timeout triggers shutdown
+func (d *Daemon) IdleRemaining() time.Duration {
+	if d.busy() {
+		return d.cfg.IdleTimeout
+	}
+
+	d.activityMu.Lock()
+	idle := time.Since(d.lastActivity)
+	d.activityMu.Unlock()
+
+	if remaining := d.cfg.IdleTimeout - idle; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
 // RecordActivity updates the last activity timestamp
 func (d *Daemon) RecordActivity() {
 	d.activityMu.Lock()
@@ -297,14 +442,13 @@ func (d *Daemon) shutdown() error {
 	return nil
 }
 
-// Status returns current daemon status
+// Status describes the daemon lifecycle (provider details are added by the handler)
 type Status struct {
 	Running       bool          `json:"running"`
 	Uptime        time.Duration `json:"uptime"`
 	IdleTime      time.Duration `json:"idle_time"`
-	Provider      string        `json:"provider"`
-	Model         string        `json:"model"`
-	Conversations int           `json:"conversations"`
+	IdleRemaining time.Duration `json:"idle_remaining"`
+	InFlight      int           `json:"in_flight"`
 }
 
 // GetStatus returns current daemon status
@@ -314,9 +458,10 @@ func (d *Daemon) GetStatus() Status {
 	d.activityMu.Unlock()
 
 	return Status{
-		Running:  true,
-		IdleTime: idleTime,
-		Provider: "openai", // TODO: Get from active provider
-		Model:    d.cfg.OpenAI.Model,
+		Running:       true,
+		Uptime:        time.Since(d.started),
+		IdleTime:      idleTime,
+		IdleRemaining: d.IdleRemaining(),
+		InFlight:      d.requests.Count(),
 	}
 }
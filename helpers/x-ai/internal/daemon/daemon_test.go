@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadConfigJSON loads a config file holding data
+func loadConfigJSON(t *testing.T, data string) (*Config, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(path)
+}
+
+func TestLoadConfigDurations(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		idle      time.Duration
+		heartbeat time.Duration
+		openai    time.Duration
+	}{
+		{"defaults", `{}`, 30 * time.Minute, 15 * time.Second, 60 * time.Second},
+		{"strings", `{"idle_timeout":"1h","heartbeat_interval":"5s","openai":{"timeout":"2m"}}`,
+			time.Hour, 5 * time.Second, 2 * time.Minute},
+		{"nanoseconds", `{"idle_timeout":60000000000}`, time.Minute, 15 * time.Second, 60 * time.Second},
+		{"null keeps default", `{"heartbeat_interval":null}`, 30 * time.Minute, 15 * time.Second, 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfigJSON(t, tt.data)
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if cfg.IdleTimeout != tt.idle || cfg.HeartbeatInterval != tt.heartbeat || cfg.OpenAI.Timeout != tt.openai {
+				t.Errorf("got idle %s, heartbeat %s, openai %s; want %s, %s, %s",
+					cfg.IdleTimeout, cfg.HeartbeatInterval, cfg.OpenAI.Timeout, tt.idle, tt.heartbeat, tt.openai)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"zero heartbeat", `{"heartbeat_interval":0}`, "heartbeat_interval"},
+		{"negative heartbeat", `{"heartbeat_interval":"-1s"}`, "heartbeat_interval"},
+		{"zero idle timeout", `{"idle_timeout":"0s"}`, "idle_timeout"},
+		{"bad duration", `{"idle_timeout":"soon"}`, "parse config"},
+		{"negative timeout", `{"ollama":{"timeout":"-5s"}}`, "timeout"},
+		{"negative misses", `{"heartbeat_misses":-1}`, "heartbeat_misses"},
+		{"negative concurrency", `{"max_concurrent":-2}`, "max_concurrent"},
+		{"empty context limit", `{"context_limits":{"llama3":0}}`, "context_limits"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfigJSON(t, tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Package daemon - durations in the config file
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// duration reads a time.Duration written as a string ("30s", "15m") or,
+// as older config files have it, an integer count of nanoseconds
+type duration time.Duration
+
+// UnmarshalJSON accepts a duration string or a number of nanoseconds
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var ns int64
+		if err := json.Unmarshal(data, &ns); err != nil {
+			return fmt.Errorf("duration must be a string like \"30s\": %s", data)
+		}
+		*d = duration(ns)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// UnmarshalJSON reads the config file, with durations as strings
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	aux := struct {
+		*plain
+		IdleTimeout       *duration `json:"idle_timeout"`
+		HeartbeatInterval *duration `json:"heartbeat_interval"`
+	}{
+		plain:             (*plain)(c),
+		IdleTimeout:       (*duration)(&c.IdleTimeout),
+		HeartbeatInterval: (*duration)(&c.HeartbeatInterval),
+	}
+	return json.Unmarshal(data, &aux)
+}
+
+// UnmarshalJSON reads OpenAI settings, with the timeout as a string
+func (c *OpenAIConfig) UnmarshalJSON(data []byte) error {
+	type plain OpenAIConfig
+	aux := struct {
+		*plain
+		Timeout *duration `json:"timeout"`
+	}{plain: (*plain)(c), Timeout: (*duration)(&c.Timeout)}
+	return json.Unmarshal(data, &aux)
+}
+
+// UnmarshalJSON reads Ollama settings, with the timeout as a string
+func (c *OllamaConfig) UnmarshalJSON(data []byte) error {
+	type plain OllamaConfig
+	aux := struct {
+		*plain
+		Timeout *duration `json:"timeout"`
+	}{plain: (*plain)(c), Timeout: (*duration)(&c.Timeout)}
+	return json.Unmarshal(data, &aux)
+}
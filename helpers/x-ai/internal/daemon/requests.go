@@ -0,0 +1,110 @@
+// Package daemon - RequestTracker keeps cancel functions for in-flight requests
+package daemon
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrDuplicateRequest is returned when a request ID is already in flight.
+// IDs are chosen by clients and shared between them, so a reused ID would
+// otherwise let one request's cancel reach another.
+var ErrDuplicateRequest = errors.New("request_id is already in use")
+
+// trackedRequest is a single in-flight request
+type trackedRequest struct {
+	requestID      string
+	conversationID string
+	cancel         context.CancelFunc
+}
+
+// RequestTracker tracks in-flight requests so they can be cancelled
+type RequestTracker struct {
+	requests map[string]*trackedRequest
+	mu       sync.Mutex
+
+	// Called when a request finishes (used for idle tracking)
+	onDone func()
+}
+
+// NewRequestTracker creates an empty request tracker
+func NewRequestTracker() *RequestTracker {
+	return &RequestTracker{
+		requests: make(map[string]*trackedRequest),
+	}
+}
+
+// Track registers a request and returns a cancellable context for it.
+// The returned done function must be called when the request finishes.
+func (t *RequestTracker) Track(parent context.Context, requestID, conversationID string) (context.Context, func(), error) {
+	ctx, cancel := context.WithCancel(parent)
+
+	req := &trackedRequest{
+		requestID:      requestID,
+		conversationID: conversationID,
+		cancel:         cancel,
+	}
+
+	t.mu.Lock()
+	if _, ok := t.requests[requestID]; ok {
+		t.mu.Unlock()
+		cancel()
+		return nil, nil, ErrDuplicateRequest
+	}
+	t.requests[requestID] = req
+	t.mu.Unlock()
+
+	done := func() {
+		t.mu.Lock()
+		if t.requests[requestID] == req {
+			delete(t.requests, requestID)
+		}
+		t.mu.Unlock()
+		cancel()
+
+		if t.onDone != nil {
+			t.onDone()
+		}
+	}
+
+	return ctx, done, nil
+}
+
+// CancelRequest cancels a single request by ID
+func (t *RequestTracker) CancelRequest(requestID string) bool {
+	t.mu.Lock()
+	req, ok := t.requests[requestID]
+	t.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	req.cancel()
+	return true
+}
+
+// CancelConversation cancels every request for a conversation
+// and returns how many were cancelled
+func (t *RequestTracker) CancelConversation(conversationID string) int {
+	t.mu.Lock()
+	var matched []*trackedRequest
+	for _, req := range t.requests {
+		if req.conversationID == conversationID {
+			matched = append(matched, req)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, req := range matched {
+		req.cancel()
+	}
+	return len(matched)
+}
+
+// Count returns the number of in-flight requests
+func (t *RequestTracker) Count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.requests)
+}
@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRequestTrackerDuplicates(t *testing.T) {
+	tracker := NewRequestTracker()
+
+	ctx, done, err := tracker.Track(context.Background(), "r1", "conv")
+	if err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+
+	// A second request with the same ID is turned away and must not
+	// take over the first one's cancel
+	if _, _, err := tracker.Track(context.Background(), "r1", "other"); !errors.Is(err, ErrDuplicateRequest) {
+		t.Fatalf("duplicate Track error = %v, want ErrDuplicateRequest", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("rejecting a duplicate cancelled the first request")
+	}
+	if n := tracker.CancelConversation("other"); n != 0 {
+		t.Errorf("rejected duplicate still tracked under its conversation (%d)", n)
+	}
+
+	// Once finished, the ID is free again
+	done()
+	if ctx.Err() == nil {
+		t.Error("done did not cancel the request context")
+	}
+	_, done2, err := tracker.Track(context.Background(), "r1", "conv")
+	if err != nil {
+		t.Fatalf("Track after done: %v", err)
+	}
+
+	// A late second call of the old done leaves the new request alone
+	done()
+	if tracker.Count() != 1 {
+		t.Errorf("stale done removed the new request")
+	}
+	done2()
+	if tracker.Count() != 0 {
+		t.Errorf("Count = %d after all requests finished", tracker.Count())
+	}
+}
+
+func TestRequestTrackerCancel(t *testing.T) {
+	tests := []struct {
+		name      string
+		cancel    func(tr *RequestTracker) int
+		want      int
+		cancelled []string // Request IDs whose context ends
+	}{
+		{"single request", func(tr *RequestTracker) int {
+			if tr.CancelRequest("r2") {
+				return 1
+			}
+			return 0
+		}, 1, []string{"r2"}},
+		{"unknown request", func(tr *RequestTracker) int {
+			if tr.CancelRequest("missing") {
+				return 1
+			}
+			return 0
+		}, 0, nil},
+		{"conversation", func(tr *RequestTracker) int {
+			return tr.CancelConversation("a")
+		}, 2, []string{"r1", "r2"}},
+		{"unknown conversation", func(tr *RequestTracker) int {
+			return tr.CancelConversation("c")
+		}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewRequestTracker()
+			finished := 0
+			tracker.onDone = func() { finished++ }
+
+			ctxs := map[string]context.Context{}
+			for _, r := range []struct{ id, conv string }{{"r1", "a"}, {"r2", "a"}, {"r3", "b"}} {
+				ctx, done, err := tracker.Track(context.Background(), r.id, r.conv)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer done()
+				ctxs[r.id] = ctx
+			}
+
+			if got := tt.cancel(tracker); got != tt.want {
+				t.Errorf("cancelled %d, want %d", got, tt.want)
+			}
+			want := map[string]bool{}
+			for _, id := range tt.cancelled {
+				want[id] = true
+			}
+			for id, ctx := range ctxs {
+				if (ctx.Err() != nil) != want[id] {
+					t.Errorf("%s cancelled = %t, want %t", id, ctx.Err() != nil, want[id])
+				}
+			}
+
+			// Cancelling doesn't finish a request, its handler still calls done
+			if tracker.Count() != 3 || finished != 0 {
+				t.Errorf("Count = %d, finished = %d after cancel; want 3, 0", tracker.Count(), finished)
+			}
+		})
+	}
+}
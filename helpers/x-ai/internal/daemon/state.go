@@ -0,0 +1,65 @@
+// Package daemon - persisted runtime state
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stateFile is the name of the state file inside the data directory
+const stateFile = "state.json"
+
+// State holds runtime choices that must survive restarts
+type State struct {
+	// Provider selected by the user (e.g. "gemini", "openai")
+	Provider string `json:"provider,omitempty"`
+
+	// Model selected for that provider
+	Model string `json:"model,omitempty"`
+}
+
+// LoadState reads the saved state, returning an empty state if none exists
+func LoadState(dataDir string) (*State, error) {
+	state := &State{}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, stateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("parse state: %w", err)
+	}
+
+	return state, nil
+}
+
+// Save writes the state atomically
+func (s *State) Save(dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal state: %w", err)
+	}
+
+	path := filepath.Join(dataDir, stateFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename state: %w", err)
+	}
+
+	return nil
+}
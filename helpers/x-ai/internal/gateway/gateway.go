@@ -0,0 +1,372 @@
+// Package gateway exposes the IPC handler over loopback HTTP.
+// Requests are translated into ipc.Messages and dispatched through the
+// same ipc.Server as Unix socket clients; streams are sent as Server-Sent Events.
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"x-ai/internal/ipc"
+)
+
+// maxBodySize limits request bodies (same as a single IPC message)
+const maxBodySize = ipc.MaxMessageSize
+
+// Config holds gateway configuration
+type Config struct {
+	// Addr to listen on; must be a loopback address
+	Addr string
+
+	// TokenFile holds the bearer token (created with mode 0600 if missing)
+	TokenFile string
+}
+
+// Gateway serves the HTTP API
+type Gateway struct {
+	ipc      *ipc.Server
+	token    string
+	server   *http.Server
+	listener net.Listener
+}
+
+// New creates a gateway bound to a loopback address
+func New(cfg Config, srv *ipc.Server) (*Gateway, error) {
+	if err := checkLoopback(cfg.Addr); err != nil {
+		return nil, err
+	}
+
+	token, err := loadToken(cfg.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Gateway{
+		ipc:   srv,
+		token: token,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat", g.handleChat)
+	mux.HandleFunc("POST /v1/retry", g.handleStream(ipc.TypeRetry))
+	mux.HandleFunc("POST /v1/edit", g.handleStream(ipc.TypeEditMessage))
+	mux.HandleFunc("POST /v1/regenerate", g.handleStream(ipc.TypeRegenerate))
+	mux.HandleFunc("POST /v1/branch", g.handleRequest(ipc.TypeSwitchBranch))
+	mux.HandleFunc("POST /v1/cancel", g.handleRequest(ipc.TypeCancel))
+	mux.HandleFunc("GET /v1/conversations", g.handleListConversations)
+	mux.HandleFunc("POST /v1/conversations", g.handleRequest(ipc.TypeNewConv))
+	mux.HandleFunc("GET /v1/conversations/{id}", g.handleConversation(ipc.TypeLoadConv))
+	mux.HandleFunc("DELETE /v1/conversations/{id}", g.handleConversation(ipc.TypeDeleteConv))
+	mux.HandleFunc("PATCH /v1/conversations/{id}", g.handleUpdateConversation)
+	mux.HandleFunc("POST /v1/search", g.handleRequest(ipc.TypeSearchConvs))
+	mux.HandleFunc("PUT /v1/provider", g.handleRequest(ipc.TypeSetProvider))
+	mux.HandleFunc("PUT /v1/model", g.handleRequest(ipc.TypeSetModel))
+	mux.HandleFunc("GET /v1/status", g.handleRequest(ipc.TypeStatus))
+
+	g.server = &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           g.authenticate(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return g, nil
+}
+
+// Start begins serving in the background
+func (g *Gateway) Start() error {
+	listener, err := net.Listen("tcp", g.server.Addr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	g.listener = listener
+
+	go func() {
+		if err := g.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP gateway error: %v", err)
+		}
+	}()
+
+	log.Printf("HTTP gateway listening on %s", listener.Addr())
+	return nil
+}
+
+// Stop shuts the gateway down, cancelling open streams
+func (g *Gateway) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return g.server.Shutdown(ctx)
+}
+
+// checkLoopback rejects addresses that are reachable from other hosts
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("refusing non-loopback address %q", addr)
+}
+
+// authenticate requires the bearer token on every request
+func (g *Gateway) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="x-ai"`)
+			writeError(w, http.StatusUnauthorized, ipc.ErrorPayload{
+				Code:    ipc.ErrCodeAuthFailed,
+				Message: "Missing or invalid bearer token",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleRequest maps a request/response endpoint onto one IPC message.
+// The JSON body (if any) becomes the message payload.
+func (g *Gateway) handleRequest(msgType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := readBody(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ipc.ErrorPayload{Code: ipc.ErrCodeInvalidReq, Message: err.Error()})
+			return
+		}
+		g.roundTrip(w, r, msgType, payload)
+	}
+}
+
+// handleConversation maps /v1/conversations/{id} onto a ConversationPayload message
+func (g *Gateway) handleConversation(msgType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := json.Marshal(ipc.ConversationPayload{ID: r.PathValue("id")})
+		g.roundTrip(w, r, msgType, payload)
+	}
+}
+
+// handleListConversations maps GET /v1/conversations?archived=&limit=
+// onto list_convs
+func (g *Gateway) handleListConversations(w http.ResponseWriter, r *http.Request) {
+	payload := ipc.ListConvsPayload{Archived: r.URL.Query().Get("archived")}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ipc.ErrorPayload{Code: ipc.ErrCodeInvalidReq, Message: "invalid limit"})
+			return
+		}
+		payload.Limit = n
+	}
+
+	data, _ := json.Marshal(payload)
+	g.roundTrip(w, r, ipc.TypeListConvs, data)
+}
+
+// handleUpdateConversation maps PATCH /v1/conversations/{id} onto update_conv
+func (g *Gateway) handleUpdateConversation(w http.ResponseWriter, r *http.Request) {
+	var payload ipc.UpdateConvPayload
+	body, err := readBody(r)
+	if err == nil && body != nil {
+		err = json.Unmarshal(body, &payload)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ipc.ErrorPayload{Code: ipc.ErrCodeInvalidReq, Message: err.Error()})
+		return
+	}
+
+	payload.ID = r.PathValue("id")
+	data, _ := json.Marshal(payload)
+	g.roundTrip(w, r, ipc.TypeUpdateConv, data)
+}
+
+// roundTrip dispatches a message and writes the first reply as JSON
+func (g *Gateway) roundTrip(w http.ResponseWriter, r *http.Request, msgType string, payload json.RawMessage) {
+	client := g.ipc.NewLocalClient(r.Context())
+	defer client.Close()
+
+	msg := newRequest(msgType, payload)
+	go g.ipc.Dispatch(client, msg)
+
+	for {
+		reply, err := client.Next(r.Context())
+		if err != nil {
+			return
+		}
+		if reply.RequestID != msg.RequestID {
+			continue
+		}
+		if reply.Type == ipc.TypeError {
+			var errPayload ipc.ErrorPayload
+			json.Unmarshal(reply.Payload, &errPayload)
+			writeError(w, statusFor(errPayload.Code), errPayload)
+			return
+		}
+		writeJSON(w, http.StatusOK, reply.Payload)
+		return
+	}
+}
+
+// handleChat streams a chat turn. Attachments are paths read by the
+// daemon, so HTTP clients may not name them: that would let any web page
+// holding the token read the user's files.
+func (g *Gateway) handleChat(w http.ResponseWriter, r *http.Request) {
+	g.stream(w, r, ipc.TypeChat, func(payload json.RawMessage) error {
+		var chat ipc.ChatPayload
+		if len(payload) > 0 {
+			if err := json.Unmarshal(payload, &chat); err != nil {
+				return fmt.Errorf("invalid chat payload: %w", err)
+			}
+		}
+		if len(chat.Attachments) > 0 {
+			return errors.New("attachments are not supported over HTTP")
+		}
+		return nil
+	})
+}
+
+// handleStream maps a chat-style endpoint onto an SSE stream. Every
+// message for the request is sent as an event named after its type;
+// the stream ends after chat_complete or error.
+func (g *Gateway) handleStream(msgType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g.stream(w, r, msgType, nil)
+	}
+}
+
+// stream sends a request and relays its replies as SSE, once check (if
+// any) has accepted the payload
+func (g *Gateway) stream(w http.ResponseWriter, r *http.Request, msgType string, check func(json.RawMessage) error) {
+	payload, err := readBody(r)
+	if err == nil && check != nil {
+		err = check(payload)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ipc.ErrorPayload{Code: ipc.ErrCodeInvalidReq, Message: err.Error()})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ipc.ErrorPayload{Code: ipc.ErrCodeInternal, Message: "Streaming unsupported"})
+		return
+	}
+
+	client := g.ipc.NewLocalClient(r.Context())
+	defer client.Close()
+
+	msg := newRequest(msgType, payload)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	go g.ipc.Dispatch(client, msg)
+
+	for {
+		reply, err := client.Next(r.Context())
+		if err != nil {
+			return // Client went away; Close cancels the request
+		}
+		if reply.RequestID != msg.RequestID && reply.Type != ipc.TypeError {
+			continue
+		}
+		if err := writeEvent(w, reply); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		if reply.Type == ipc.TypeChatComplete || reply.Type == ipc.TypeError {
+			return
+		}
+	}
+}
+
+// newRequest builds an IPC request message
+func newRequest(msgType string, payload json.RawMessage) *ipc.Message {
+	msg, _ := ipc.NewMessage(msgType, nil)
+	msg.Payload = payload
+	return msg
+}
+
+// readBody reads an optional JSON request body
+func readBody(r *http.Request) (json.RawMessage, error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if len(data) > maxBodySize {
+		return nil, fmt.Errorf("body exceeds %d bytes", maxBodySize)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if !json.Valid(data) {
+		return nil, errors.New("body is not valid JSON")
+	}
+	return data, nil
+}
+
+// writeEvent writes one SSE event
+func writeEvent(w io.Writer, msg *ipc.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+	return err
+}
+
+// writeJSON writes a raw JSON response
+func writeJSON(w http.ResponseWriter, status int, body json.RawMessage) {
+	if len(body) == 0 {
+		body = json.RawMessage("{}")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+	w.Write([]byte("\n"))
+}
+
+// writeError writes an ErrorPayload response
+func writeError(w http.ResponseWriter, status int, payload ipc.ErrorPayload) {
+	body, _ := json.Marshal(payload)
+	writeJSON(w, status, body)
+}
+
+// statusFor maps IPC error codes to HTTP status codes
+func statusFor(code string) int {
+	switch code {
+	case ipc.ErrCodeInvalidReq:
+		return http.StatusBadRequest
+	case ipc.ErrCodeAuthFailed:
+		return http.StatusServiceUnavailable // No usable provider credentials
+	case ipc.ErrCodeRateLimit:
+		return http.StatusTooManyRequests
+	case ipc.ErrCodeNetworkErr, ipc.ErrCodeServerDown:
+		return http.StatusBadGateway
+	case ipc.ErrCodeTokenLimit:
+		return http.StatusRequestEntityTooLarge
+	case ipc.ErrCodeCancelled:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
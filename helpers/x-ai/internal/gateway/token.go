@@ -0,0 +1,68 @@
+// Package gateway - bearer token file
+package gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadToken reads the bearer token, creating one if the file is missing.
+// The file must not be readable by group or others.
+func loadToken(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("token file path is required")
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return createToken(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("stat token file: %w", err)
+	}
+
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return "", fmt.Errorf("token file %s has mode %04o, want 0600", path, perm)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if len(token) < 32 {
+		return "", fmt.Errorf("token in %s is too short", path)
+	}
+	return token, nil
+}
+
+// createToken writes a new random token with mode 0600
+func createToken(path string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("create token dir: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("create token file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(token + "\n"); err != nil {
+		return "", fmt.Errorf("write token file: %w", err)
+	}
+
+	return token, nil
+}
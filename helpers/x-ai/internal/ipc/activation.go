@@ -0,0 +1,52 @@
+// Package ipc - systemd socket activation
+package ipc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd (SD_LISTEN_FDS_START)
+const listenFdsStart = 3
+
+// activationListener returns the listener passed in by systemd socket
+// activation, or nil if the process was not socket-activated.
+// It follows the sd_listen_fds(3) protocol: LISTEN_PID must match our
+// PID and LISTEN_FDS gives the number of inherited descriptors.
+func activationListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds < 1 {
+		return nil, nil
+	}
+
+	// Don't let child processes think they were activated too
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	// x-ai.socket declares a single ListenStream, so only the first fd is used
+	f := os.NewFile(uintptr(listenFdsStart), "x-ai.socket")
+	if f == nil {
+		return nil, fmt.Errorf("invalid activation fd %d", listenFdsStart)
+	}
+	defer f.Close()
+
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("activation listener: %w", err)
+	}
+
+	if _, ok := listener.(*net.UnixListener); !ok {
+		listener.Close()
+		return nil, fmt.Errorf("activation fd is not a unix socket")
+	}
+
+	return listener, nil
+}
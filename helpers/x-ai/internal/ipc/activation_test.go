@@ -0,0 +1,172 @@
+package ipc
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The activation tests re-run the test binary with a listening socket
+// inherited as fd 3, the way systemd starts a socket-activated daemon.
+// Since LISTEN_PID must name the child, which only exists after the fork,
+// activationChildPID asks the child to fill it in itself.
+const (
+	activationChildEnv  = "X_AI_TEST_ACTIVATION_CHILD"
+	activationChildPID  = "X_AI_TEST_LISTEN_PID_SELF"
+	activationSocketEnv = "X_AI_TEST_SOCKET"
+)
+
+// TestActivationChild is the subprocess side: it creates a server and
+// reports whether it was activated and where it listens, then greets
+// the first client
+func TestActivationChild(t *testing.T) {
+	if os.Getenv(activationChildEnv) == "" {
+		t.Skip("run by the activation tests")
+	}
+	if os.Getenv(activationChildPID) != "" {
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	}
+
+	srv, err := NewServer(os.Getenv(activationSocketEnv), nil)
+	if err != nil {
+		fmt.Printf("error %v\n", err)
+		return
+	}
+	defer srv.listener.Close()
+
+	fmt.Printf("activated=%t addr=%s\n", srv.activated, srv.listener.Addr())
+
+	srv.listener.(*net.UnixListener).SetDeadline(time.Now().Add(5 * time.Second))
+	conn, err := srv.listener.Accept()
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(conn, "hello from child")
+	conn.Close()
+}
+
+// runActivationChild starts the child with the listener at inherited as
+// fd 3 and env added, and returns its first line of output
+func runActivationChild(t *testing.T, inherited *net.UnixListener, env ...string) string {
+	t.Helper()
+
+	f, err := inherited.File()
+	if err != nil {
+		t.Fatalf("listener file: %v", err)
+	}
+	defer f.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestActivationChild$")
+	cmd.ExtraFiles = []*os.File{f} // Becomes fd 3
+	cmd.Env = append(filterEnv(os.Environ(), "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"),
+		activationChildEnv+"=1")
+	cmd.Env = append(cmd.Env, env...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start child: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read child output: %v", err)
+	}
+	return strings.TrimSpace(line)
+}
+
+// filterEnv drops the named variables from env
+func filterEnv(env []string, names ...string) []string {
+	kept := env[:0:0]
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		drop := false
+		for _, n := range names {
+			drop = drop || name == n
+		}
+		if !drop {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+// inheritedListener creates the socket the "service manager" hands over
+func inheritedListener(t *testing.T) (*net.UnixListener, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "activated.sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener, path
+}
+
+func TestActivationUsesInheritedListener(t *testing.T) {
+	inherited, path := inheritedListener(t)
+	fallback := filepath.Join(t.TempDir(), "run", "fallback.sock") // Created 0700 by the server
+
+	line := runActivationChild(t, inherited,
+		activationChildPID+"=1", "LISTEN_FDS=1", activationSocketEnv+"="+fallback)
+
+	if want := "activated=true addr=" + path; line != want {
+		t.Fatalf("child reported %q, want %q", line, want)
+	}
+	if _, err := os.Stat(fallback); !os.IsNotExist(err) {
+		t.Errorf("activated server created %s", fallback)
+	}
+
+	// The parent never accepts, so the greeting proves the child serves fd 3
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		t.Fatalf("dial inherited socket: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	greeting, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || greeting != "hello from child\n" {
+		t.Fatalf("greeting = %q, %v", greeting, err)
+	}
+}
+
+func TestActivationFallsBackWithoutMatchingPID(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+	}{
+		{"unset", []string{"LISTEN_FDS=1"}},
+		{"mismatched", []string{"LISTEN_FDS=1", "LISTEN_PID=" + strconv.Itoa(os.Getpid())}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inherited, _ := inheritedListener(t)
+			fallback := filepath.Join(t.TempDir(), "run", "fallback.sock") // Created 0700 by the server
+
+			line := runActivationChild(t, inherited, append(tt.env, activationSocketEnv+"="+fallback)...)
+
+			if want := "activated=false addr=" + fallback; line != want {
+				t.Fatalf("child reported %q, want %q", line, want)
+			}
+			if info, err := os.Stat(fallback); err != nil || info.Mode()&os.ModeSocket == 0 {
+				t.Errorf("fallback socket not created: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+// Package ipc - client side of the socket protocol (used by the CLI)
+package ipc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxReplySize bounds a single reply line (conversation loads can exceed
+// MaxMessageSize, which only limits requests)
+const maxReplySize = 16 * 1024 * 1024
+
+// ErrClosed is returned once the daemon closes the connection
+var ErrClosed = errors.New("connection closed by daemon")
+
+// RemoteError is an error reply from the daemon
+type RemoteError struct {
+	ErrorPayload
+}
+
+func (e *RemoteError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Conn is a client connection to the daemon. Heartbeats are answered
+// implicitly by a background reader that keeps the socket drained.
+type Conn struct {
+	conn     net.Conn
+	incoming chan *Message
+	writeMu  sync.Mutex
+
+	// Set before incoming is closed
+	err error
+}
+
+// Dial connects to the daemon socket
+func Dial(socketPath string, timeout time.Duration) (*Conn, error) {
+	conn, err := net.DialTimeout("unix", socketPath, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", socketPath, err)
+	}
+
+	c := &Conn{
+		conn:     conn,
+		incoming: make(chan *Message, 64),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// readLoop reads newline-delimited messages until the connection ends
+func (c *Conn) readLoop() {
+	defer close(c.incoming)
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 64*1024), maxReplySize)
+
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Type == TypeHeartbeat {
+			// Answer so the daemon knows we are still reading
+			pong, _ := msg.Response(TypePong, HeartbeatPayload{Timestamp: time.Now().UnixMilli()})
+			go c.Send(pong)
+			continue
+		}
+		c.incoming <- &msg
+	}
+
+	c.err = scanner.Err()
+	if c.err == nil {
+		c.err = ErrClosed
+	}
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Send writes a message
+func (c *Conn) Send(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+	data = append(data, '\n')
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(data); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+// Request sends a new request and returns it (for its RequestID)
+func (c *Conn) Request(msgType string, payload interface{}) (*Message, error) {
+	msg, err := NewMessage(msgType, payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Send(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Next returns the next message from the daemon (heartbeats excluded)
+func (c *Conn) Next(ctx context.Context) (*Message, error) {
+	select {
+	case msg, ok := <-c.incoming:
+		if !ok {
+			return nil, c.err
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Call sends a request and waits for its first reply. Error replies are
+// returned as *RemoteError; replies to other requests are skipped.
+func (c *Conn) Call(ctx context.Context, msgType string, payload interface{}) (*Message, error) {
+	req, err := c.Request(msgType, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		reply, err := c.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if reply.RequestID != req.RequestID {
+			continue
+		}
+		if err := ReplyError(reply); err != nil {
+			return nil, err
+		}
+		return reply, nil
+	}
+}
+
+// ReplyError returns the *RemoteError carried by an error reply, or nil
+func ReplyError(msg *Message) error {
+	if msg.Type != TypeError {
+		return nil
+	}
+
+	remote := &RemoteError{}
+	if err := json.Unmarshal(msg.Payload, &remote.ErrorPayload); err != nil {
+		remote.Code = ErrCodeInternal
+		remote.Message = "invalid error payload"
+	}
+	return remote
+}
+
+// Hello performs the protocol handshake
+func (c *Conn) Hello(ctx context.Context, client string) (*HelloReplyPayload, error) {
+	reply, err := c.Call(ctx, TypeHello, HelloPayload{
+		ProtocolVersion: ProtocolVersion,
+		Client:          client,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var hello HelloReplyPayload
+	if err := json.Unmarshal(reply.Payload, &hello); err != nil {
+		return nil, fmt.Errorf("invalid hello reply: %w", err)
+	}
+	return &hello, nil
+}
@@ -0,0 +1,78 @@
+// Package ipc - heartbeats and dead client reaping
+package ipc
+
+import (
+	"log"
+	"time"
+)
+
+// writeTimeout bounds a single write so a stuck reader cannot block its writer forever
+const writeTimeout = 10 * time.Second
+
+// Heartbeat sends a heartbeat to every client and disconnects clients
+// that sent nothing for maxMissed heartbeats in a row. Clients answer
+// heartbeats with a pong, so an idle client stays connected while a hung
+// one is dropped even if its socket still has buffer space. Clients that
+// stopped reading their stream are dropped here too (see outbox.lagging).
+func (s *Server) Heartbeat(maxMissed int) {
+	msg, _ := NewMessage(TypeHeartbeat, HeartbeatPayload{
+		Timestamp: time.Now().UnixMilli(),
+	})
+
+	s.clientsMu.RLock()
+	clients := make([]*Client, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.clientsMu.RUnlock()
+
+	for _, client := range clients {
+		// Catch clients that stalled after the last stream data was queued
+		if client.out.lagging() {
+			client.dropSlow()
+			continue
+		}
+
+		// Nothing received since the last tick counts as a miss
+		if client.heartbeatPending.Swap(true) {
+			missed := client.missedHeartbeats.Add(1)
+			if maxMissed > 0 && int(missed) >= maxMissed {
+				log.Printf("IPC client %s missed %d heartbeats, disconnecting", client.id, missed)
+				client.close()
+				continue
+			}
+		}
+		client.Send(msg)
+	}
+}
+
+// handlePing answers a client ping with a pong and absorbs the pongs
+// answering heartbeats. Returns false for any other message.
+func (s *Server) handlePing(client *Client, msg *Message) bool {
+	if msg.Type == TypePong {
+		return true
+	}
+	if msg.Type != TypePing {
+		return false
+	}
+
+	pong, _ := msg.Response(TypePong, HeartbeatPayload{
+		Timestamp: time.Now().UnixMilli(),
+	})
+	client.Send(pong)
+	return true
+}
+
+// markAlive records that the client sent something since the last heartbeat
+func (c *Client) markAlive() {
+	c.heartbeatPending.Store(false)
+	c.missedHeartbeats.Store(0)
+}
+
+// close disconnects the client
+func (c *Client) close() {
+	c.cancel()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
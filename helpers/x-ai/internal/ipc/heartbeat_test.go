@@ -0,0 +1,90 @@
+package ipc
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nopHandler ignores every request
+type nopHandler struct{}
+
+func (nopHandler) HandleMessage(ctx context.Context, client *Client, msg *Message) error {
+	return nil
+}
+
+// startTestServer runs a server on a socket in a private temp directory
+func startTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "run", "x-ai.sock")
+	srv, err := NewServer(path, nopHandler{})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	srv.Start()
+	t.Cleanup(func() { srv.Stop() })
+	return srv, path
+}
+
+// waitClients waits until the server has n clients
+func waitClients(t *testing.T, srv *Server, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.ClientCount() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("server has %d clients, want %d", srv.ClientCount(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHeartbeatReaping(t *testing.T) {
+	tests := []struct {
+		name      string
+		answers   bool // Client answers heartbeats (ipc.Dial does)
+		ticks     int
+		connected bool
+	}{
+		{"silent client survives until the limit", false, 2, true},
+		{"silent client is dropped", false, 3, false},
+		{"answering client stays", true, 6, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, path := startTestServer(t)
+
+			if tt.answers {
+				conn, err := Dial(path, time.Second)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+			} else {
+				// Never reads or writes, like a hung client whose socket
+				// buffer still has room for the heartbeats
+				conn, err := net.Dial("unix", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+			}
+			waitClients(t, srv, 1)
+
+			for i := 0; i < tt.ticks; i++ {
+				srv.Heartbeat(2)
+				time.Sleep(50 * time.Millisecond) // Room for the pong
+			}
+
+			if tt.connected {
+				waitClients(t, srv, 1)
+			} else {
+				waitClients(t, srv, 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Package ipc - in-process clients for other transports
+package ipc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// NewLocalClient creates a client that is not backed by a socket.
+// Other transports (e.g. the HTTP gateway) use it to reuse the same
+// handler; replies are read with Next. The client is not
+// registered with the server, so it receives no broadcasts or heartbeats.
+// It is closed when ctx is done.
+func (s *Server) NewLocalClient(ctx context.Context) *Client {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Client{
+		id:     uuid.New().String(),
+		server: s,
+		out:    newOutbox(),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Next waits for the next message sent to a local client
+func (c *Client) Next(ctx context.Context) (*Message, error) {
+	msg, err := c.out.pop(ctx)
+	if errors.Is(err, errOutboxFailed) {
+		c.cancel()
+	}
+	return msg, err
+}
+
+// Close releases a local client and cancels its requests
+func (c *Client) Close() {
+	c.cancel()
+	c.out.close()
+}
+
+// Dispatch processes a request from a local client exactly as if it had
+// arrived on the socket. It blocks until the handler returns.
+func (s *Server) Dispatch(client *Client, msg *Message) {
+	if s.handleInline(client, msg) {
+		return
+	}
+	s.dispatch(s.prepare(client, msg), client, msg)
+}
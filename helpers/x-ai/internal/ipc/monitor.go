@@ -0,0 +1,203 @@
+// Package ipc - traffic monitor for debugging (x-ai watch)
+package ipc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Monitor directions
+const (
+	DirectionIn  = "in"  // Client → daemon
+	DirectionOut = "out" // Daemon → client
+)
+
+// plainKeys are the payload fields still shown when a monitor asks for
+// redaction: IDs, enums and names chosen by the daemon. Every other text
+// is hidden, so fields added later are redacted until listed here.
+var plainKeys = map[string]bool{
+	"type":            true,
+	"id":              true,
+	"request_id":      true,
+	"conversation_id": true,
+	"message_id":      true,
+	"parent_id":       true,
+	"active_leaf":     true,
+	"client":          true,
+	"client_id":       true,
+	"direction":       true,
+	"role":            true,
+	"code":            true,
+	"reason":          true,
+	"provider":        true,
+	"providers":       true,
+	"model":           true,
+	"finish_reason":   true,
+	"mime_type":       true,
+	"content_hash":    true,
+	"circuit":         true,
+	"archived":        true,
+	"message_types":   true,
+	"version":         true,
+	"daemon_version":  true,
+	"created_at":      true,
+	"updated_at":      true,
+}
+
+// MonitorPayload for monitor requests
+type MonitorPayload struct {
+	Redact bool `json:"redact"` // Hide all text but IDs and names set by the daemon
+}
+
+// MonitorEventPayload carries one mirrored message
+type MonitorEventPayload struct {
+	Direction string   `json:"direction"` // "in" or "out"
+	ClientID  string   `json:"client_id"`
+	Local     bool     `json:"local,omitempty"` // In-process client (HTTP gateway)
+	Message   *Message `json:"message"`
+}
+
+// monitor is a client watching traffic
+type monitor struct {
+	client *Client
+	redact bool
+}
+
+// handleMonitor registers a socket client as a traffic monitor.
+// Local clients are refused: the HTTP gateway must not expose other
+// clients' traffic. Monitoring lasts until the client disconnects.
+// Returns false if the message is not a monitor request.
+func (s *Server) handleMonitor(client *Client, msg *Message) bool {
+	if msg.Type != TypeMonitor {
+		return false
+	}
+
+	if client.conn == nil {
+		s.sendError(client, msg.RequestID, ErrCodeInvalidReq, "monitor is only available on the socket", false)
+		return true
+	}
+
+	var payload MonitorPayload
+	if len(msg.Payload) > 0 {
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			s.sendError(client, msg.RequestID, ErrCodeInvalidReq, "Invalid payload", false)
+			return true
+		}
+	}
+
+	s.monitorsMu.Lock()
+	if _, ok := s.monitors[client.id]; !ok {
+		s.monitoring.Add(1)
+	}
+	s.monitors[client.id] = &monitor{client: client, redact: payload.Redact}
+	s.monitorsMu.Unlock()
+	log.Printf("IPC client %s is monitoring traffic (redact: %v)", client.id, payload.Redact)
+
+	ack, _ := msg.Response(TypeAck, payload)
+	client.Send(ack)
+	return true
+}
+
+// removeMonitor stops mirroring traffic to a client
+func (s *Server) removeMonitor(client *Client) {
+	s.monitorsMu.Lock()
+	defer s.monitorsMu.Unlock()
+
+	if _, ok := s.monitors[client.id]; ok {
+		delete(s.monitors, client.id)
+		s.monitoring.Add(-1)
+	}
+}
+
+// mirror copies a message to every monitor. Traffic of monitoring
+// clients themselves is not mirrored.
+func (s *Server) mirror(client *Client, direction string, msg *Message) {
+	if s.monitoring.Load() == 0 || msg.Type == TypeMonitorEvent {
+		return
+	}
+
+	s.monitorsMu.RLock()
+	defer s.monitorsMu.RUnlock()
+
+	if _, ok := s.monitors[client.id]; ok {
+		return
+	}
+
+	var plain, redacted *Message
+	for _, m := range s.monitors {
+		var event *Message
+		if m.redact {
+			if redacted == nil {
+				redacted = s.monitorEvent(client, direction, redactMessage(msg))
+			}
+			event = redacted
+		} else {
+			if plain == nil {
+				plain = s.monitorEvent(client, direction, msg)
+			}
+			event = plain
+		}
+		if event != nil {
+			m.client.Send(event)
+		}
+	}
+}
+
+// monitorEvent wraps a mirrored message
+func (s *Server) monitorEvent(client *Client, direction string, msg *Message) *Message {
+	event, err := NewMessage(TypeMonitorEvent, MonitorEventPayload{
+		Direction: direction,
+		ClientID:  client.id,
+		Local:     client.conn == nil,
+		Message:   msg,
+	})
+	if err != nil {
+		log.Printf("IPC monitor: %v", err)
+		return nil
+	}
+	return event
+}
+
+// redactMessage returns a copy of msg with content fields replaced by
+// their length
+func redactMessage(msg *Message) *Message {
+	if len(msg.Payload) == 0 {
+		return msg
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return msg
+	}
+
+	data, err := json.Marshal(redactValue(payload, false))
+	if err != nil {
+		return msg
+	}
+
+	copied := *msg
+	copied.Payload = data
+	return &copied
+}
+
+// redactValue walks a decoded JSON value and hides every string not
+// stored under plainKeys. Objects and lists are walked rather than
+// hidden, and values that carry no content (flags, numbers) are kept.
+func redactValue(v interface{}, plain bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			v[key] = redactValue(field, plainKeys[key])
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i], plain)
+		}
+	case string:
+		if !plain && v != "" {
+			return fmt.Sprintf("[redacted: %d chars]", len([]rune(v)))
+		}
+	}
+	return v
+}
@@ -0,0 +1,62 @@
+package ipc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"content hidden, IDs kept",
+			`{"conversation_id":"c1","message_id":"m1","content":"hello"}`,
+			`{"content":"[redacted: 5 chars]","conversation_id":"c1","message_id":"m1"}`},
+		{"search query and snippets",
+			`{"query":"secret","results":[{"id":"c1","title":"Tax","snippet":"my income"}]}`,
+			`{"query":"[redacted: 6 chars]","results":[{"id":"c1","snippet":"[redacted: 9 chars]","title":"[redacted: 3 chars]"}]}`},
+		{"enums kept",
+			`{"code":"cancelled","model":"gpt-4o","provider":"openai","role":"user","message":"boom"}`,
+			`{"code":"cancelled","message":"[redacted: 4 chars]","model":"gpt-4o","provider":"openai","role":"user"}`},
+		{"length counts characters",
+			`{"content":"日本語"}`,
+			`{"content":"[redacted: 3 chars]"}`},
+		{"numbers, flags and empty strings kept",
+			`{"tokens":42,"done":true,"content":"","extra":null}`,
+			`{"content":"","done":true,"extra":null,"tokens":42}`},
+		{"unknown fields hidden",
+			`{"new_field":"text","nested":{"deeper":["a","bc"]}}`,
+			`{"nested":{"deeper":["[redacted: 1 chars]","[redacted: 2 chars]"]},"new_field":"[redacted: 4 chars]"}`},
+		{"list of plain values",
+			`{"message_types":["chat","search"]}`,
+			`{"message_types":["chat","search"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{Type: TypeChat, RequestID: "r1", Payload: json.RawMessage(tt.payload)}
+
+			got := redactMessage(msg)
+			if string(got.Payload) != tt.want {
+				t.Errorf("payload = %s\nwant %s", got.Payload, tt.want)
+			}
+			if got.Type != msg.Type || got.RequestID != msg.RequestID {
+				t.Errorf("envelope changed: %s %s", got.Type, got.RequestID)
+			}
+			if string(msg.Payload) != tt.payload {
+				t.Errorf("original payload changed to %s", msg.Payload)
+			}
+		})
+	}
+}
+
+func TestRedactMessageWithoutPayload(t *testing.T) {
+	for _, payload := range []string{"", "not json"} {
+		msg := &Message{Type: TypeHeartbeat, Payload: json.RawMessage(payload)}
+		if got := redactMessage(msg); got != msg {
+			t.Errorf("payload %q: got a copy, want the message unchanged", payload)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Package ipc - per-client outbound queue with flow control
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Flow control limits for a single client
+const (
+	// maxPendingBytes is the most payload data queued for a client
+	maxPendingBytes = 8 * 1024 * 1024
+
+	// maxLag is how long the oldest queued message may wait
+	maxLag = 30 * time.Second
+)
+
+var (
+	// errOutboxClosed is returned once the client is gone
+	errOutboxClosed = errors.New("outbox closed")
+
+	// errOutboxFailed is returned after the final error has been delivered
+	errOutboxFailed = errors.New("client too slow")
+)
+
+// isControl reports whether a message type jumps ahead of stream data.
+// These never depend on the order of chunks around them.
+func isControl(msgType string) bool {
+	switch msgType {
+	case TypeHeartbeat, TypePong, TypeAck, TypeStatus, TypeHello, TypeQueued:
+		return true
+	}
+	return false
+}
+
+// queued is a message waiting to be written
+type queued struct {
+	msg      *Message
+	chunk    *ChatChunkPayload // Decoded chunk, kept for merging
+	merged   bool              // Payload must be re-encoded from chunk
+	size     int               // Bytes counted against maxPendingBytes
+	enqueued time.Time
+}
+
+// outbox queues messages for a client without ever dropping stream data.
+// Consecutive chunks of the same message are merged while the client
+// lags; control messages are delivered first. A client that falls too
+// far behind gets a final error and is then disconnected.
+type outbox struct {
+	mu      sync.Mutex
+	control []*queued
+	data    []*queued
+	bytes   int
+	closed  bool
+	failed  bool
+	notify  chan struct{}
+}
+
+// newOutbox creates an empty outbox
+func newOutbox() *outbox {
+	return &outbox{
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// push queues a message. It returns false if the client has lagged too
+// far behind; the outbox then holds only a final error message.
+func (o *outbox) push(msg *Message) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed || o.failed {
+		return true
+	}
+
+	now := time.Now()
+	if isControl(msg.Type) {
+		o.control = append(o.control, &queued{msg: msg, enqueued: now})
+		o.signal()
+		return true
+	}
+
+	if msg.Type == TypeChatChunk && o.merge(msg) {
+		o.signal()
+		return o.healthy(now)
+	}
+
+	item := &queued{msg: msg, size: len(msg.Payload), enqueued: now}
+	if msg.Type == TypeChatChunk {
+		var chunk ChatChunkPayload
+		if json.Unmarshal(msg.Payload, &chunk) == nil {
+			item.chunk = &chunk
+		}
+	}
+
+	o.data = append(o.data, item)
+	o.bytes += item.size
+	o.signal()
+	return o.healthy(now)
+}
+
+// merge appends a chunk to the last queued chunk of the same message.
+// Must be called with o.mu held.
+func (o *outbox) merge(msg *Message) bool {
+	if len(o.data) == 0 {
+		return false
+	}
+
+	last := o.data[len(o.data)-1]
+	if last.chunk == nil || last.chunk.Done || last.msg.RequestID != msg.RequestID {
+		return false
+	}
+
+	var chunk ChatChunkPayload
+	if err := json.Unmarshal(msg.Payload, &chunk); err != nil {
+		return false
+	}
+	if chunk.ConversationID != last.chunk.ConversationID || chunk.MessageID != last.chunk.MessageID {
+		return false
+	}
+
+	last.chunk.Content += chunk.Content
+	last.chunk.Done = chunk.Done
+	last.merged = true
+	last.size += len(chunk.Content)
+	o.bytes += len(chunk.Content)
+	return true
+}
+
+// healthy checks the lag limits. Must be called with o.mu held.
+func (o *outbox) healthy(now time.Time) bool {
+	if o.bytes > maxPendingBytes {
+		return false
+	}
+	if len(o.data) > 0 && now.Sub(o.data[0].enqueued) > maxLag {
+		return false
+	}
+	return true
+}
+
+// lagging reports whether the client broke the lag limits since the last
+// push. Without it a client that stalls on the last chunks of a reply
+// would only be caught by the next message, which may never come.
+func (o *outbox) lagging() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return !o.closed && !o.failed && !o.healthy(time.Now())
+}
+
+// fail drops queued data and leaves only a final message to deliver
+func (o *outbox) fail(final *Message) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed || o.failed {
+		return
+	}
+
+	o.failed = true
+	o.control = []*queued{{msg: final, enqueued: time.Now()}}
+	o.data = nil
+	o.bytes = 0
+	o.signal()
+}
+
+// close stops the outbox; pending messages are discarded
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.closed = true
+	o.control = nil
+	o.data = nil
+	o.signal()
+}
+
+// signal wakes a waiting pop. Must be called with o.mu held.
+func (o *outbox) signal() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop waits for the next message to write
+func (o *outbox) pop(ctx context.Context) (*Message, error) {
+	for {
+		o.mu.Lock()
+		if o.closed {
+			o.mu.Unlock()
+			return nil, errOutboxClosed
+		}
+
+		var item *queued
+		if len(o.control) > 0 {
+			item = o.control[0]
+			o.control = o.control[1:]
+		} else if len(o.data) > 0 {
+			item = o.data[0]
+			o.data = o.data[1:]
+			o.bytes -= item.size
+		} else if o.failed {
+			o.mu.Unlock()
+			return nil, errOutboxFailed
+		}
+		o.mu.Unlock()
+
+		if item != nil {
+			if item.merged {
+				payload, err := json.Marshal(item.chunk)
+				if err == nil {
+					merged := *item.msg
+					merged.Payload = payload
+					return &merged, nil
+				}
+			}
+			return item.msg, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-o.notify:
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// chunkMsg builds a chat_chunk for request reqID
+func chunkMsg(t *testing.T, reqID, messageID, content string, done bool) *Message {
+	t.Helper()
+
+	msg, err := NewMessage(TypeChatChunk, ChatChunkPayload{
+		ConversationID: "conv",
+		MessageID:      messageID,
+		Content:        content,
+		Done:           done,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.RequestID = reqID
+	return msg
+}
+
+// typedMsg builds a message of msgType for request reqID
+func typedMsg(t *testing.T, msgType, reqID string) *Message {
+	t.Helper()
+
+	msg, err := NewMessage(msgType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.RequestID = reqID
+	return msg
+}
+
+// drain pops everything queued, describing chunks by their content
+func drain(t *testing.T, o *outbox) []string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var got []string
+	for {
+		msg, err := o.pop(ctx)
+		if err != nil {
+			return got
+		}
+		if msg.Type != TypeChatChunk {
+			got = append(got, msg.Type)
+			continue
+		}
+		var chunk ChatChunkPayload
+		if err := json.Unmarshal(msg.Payload, &chunk); err != nil {
+			t.Fatalf("merged chunk: %v", err)
+		}
+		if chunk.Done {
+			chunk.Content += "|done"
+		}
+		got = append(got, chunk.Content)
+	}
+}
+
+func TestOutboxMergesChunks(t *testing.T) {
+	tests := []struct {
+		name string
+		push func(t *testing.T) []*Message
+		want []string
+	}{
+		{"same message", func(t *testing.T) []*Message {
+			return []*Message{chunkMsg(t, "r1", "m1", "a", false), chunkMsg(t, "r1", "m1", "b", false), chunkMsg(t, "r1", "m1", "c", true)}
+		}, []string{"abc|done"}},
+		{"other request", func(t *testing.T) []*Message {
+			return []*Message{chunkMsg(t, "r1", "m1", "a", false), chunkMsg(t, "r2", "m1", "b", false)}
+		}, []string{"a", "b"}},
+		{"other message", func(t *testing.T) []*Message {
+			return []*Message{chunkMsg(t, "r1", "m1", "a", false), chunkMsg(t, "r1", "m2", "b", false)}
+		}, []string{"a", "b"}},
+		{"after done", func(t *testing.T) []*Message {
+			return []*Message{chunkMsg(t, "r1", "m1", "a", true), chunkMsg(t, "r1", "m1", "b", false)}
+		}, []string{"a|done", "b"}},
+		{"not across other data", func(t *testing.T) []*Message {
+			return []*Message{chunkMsg(t, "r1", "m1", "a", false), typedMsg(t, TypeError, "r1"), chunkMsg(t, "r1", "m1", "b", false)}
+		}, []string{"a", TypeError, "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOutbox()
+			for _, msg := range tt.push(t) {
+				if !o.push(msg) {
+					t.Fatal("push reported a lagging client")
+				}
+			}
+
+			got := drain(t, o)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %q, want %q", got, tt.want)
+				}
+			}
+			if o.bytes != 0 {
+				t.Errorf("%d bytes still counted after draining", o.bytes)
+			}
+		})
+	}
+}
+
+func TestOutboxControlFirst(t *testing.T) {
+	o := newOutbox()
+	o.push(chunkMsg(t, "r1", "m1", "a", false))
+	o.push(typedMsg(t, TypeChatComplete, "r1"))
+	o.push(typedMsg(t, TypeHeartbeat, ""))
+	o.push(typedMsg(t, TypeQueued, "r2"))
+	o.push(typedMsg(t, TypeAck, "r2"))
+
+	got := drain(t, o)
+	want := []string{TypeHeartbeat, TypeQueued, TypeAck, "a", TypeChatComplete}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestOutboxLag(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, o *outbox) bool // Returns the last push result
+		healthy bool
+		lagging bool
+	}{
+		{"fresh data", func(t *testing.T, o *outbox) bool {
+			return o.push(chunkMsg(t, "r1", "m1", "a", false))
+		}, true, false},
+		{"too many bytes", func(t *testing.T, o *outbox) bool {
+			big := make([]byte, maxPendingBytes)
+			for i := range big {
+				big[i] = 'x'
+			}
+			return o.push(chunkMsg(t, "r1", "m1", string(big), false))
+		}, false, true},
+		{"old data, nothing pushed since", func(t *testing.T, o *outbox) bool {
+			ok := o.push(chunkMsg(t, "r1", "m1", "a", false))
+			o.data[0].enqueued = time.Now().Add(-maxLag - time.Second)
+			return ok
+		}, true, true},
+		{"old data, caught by the next push", func(t *testing.T, o *outbox) bool {
+			o.push(chunkMsg(t, "r1", "m1", "a", false))
+			o.data[0].enqueued = time.Now().Add(-maxLag - time.Second)
+			return o.push(chunkMsg(t, "r1", "m1", "b", false))
+		}, false, true},
+		{"old control message only", func(t *testing.T, o *outbox) bool {
+			ok := o.push(typedMsg(t, TypeHeartbeat, ""))
+			o.control[0].enqueued = time.Now().Add(-maxLag - time.Second)
+			return ok
+		}, true, false},
+		{"already failed", func(t *testing.T, o *outbox) bool {
+			o.push(chunkMsg(t, "r1", "m1", "a", false))
+			o.data[0].enqueued = time.Now().Add(-maxLag - time.Second)
+			o.fail(typedMsg(t, TypeError, ""))
+			return true
+		}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOutbox()
+			if got := tt.setup(t, o); got != tt.healthy {
+				t.Errorf("push = %t, want %t", got, tt.healthy)
+			}
+			if got := o.lagging(); got != tt.lagging {
+				t.Errorf("lagging = %t, want %t", got, tt.lagging)
+			}
+		})
+	}
+}
+
+func TestHeartbeatDropsStalledStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// No writer runs, so queued data stays queued like a client that
+	// stopped reading
+	srv := &Server{clients: map[string]*Client{}}
+	client := &Client{id: "c1", server: srv, out: newOutbox(), ctx: ctx, cancel: cancel}
+	srv.clients[client.id] = client
+
+	client.Send(chunkMsg(t, "r1", "m1", "last words", false))
+	client.out.data[0].enqueued = time.Now().Add(-maxLag - time.Second)
+
+	srv.Heartbeat(0)
+
+	msg, err := client.out.pop(ctx)
+	if err != nil || msg.Type != TypeError {
+		t.Fatalf("first message = %v, %v; want the final error", msg, err)
+	}
+	var payload ErrorPayload
+	json.Unmarshal(msg.Payload, &payload)
+	if payload.Code != ErrCodeSlowClient {
+		t.Errorf("error code = %q, want %q", payload.Code, ErrCodeSlowClient)
+	}
+	if _, err := client.out.pop(ctx); !errors.Is(err, errOutboxFailed) {
+		t.Errorf("after the final error: %v, want errOutboxFailed", err)
+	}
+}
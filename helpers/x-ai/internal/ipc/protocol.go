@@ -0,0 +1,50 @@
+// Package ipc - protocol versioning and handshake
+package ipc
+
+// Protocol versions supported by this build.
+// Bump ProtocolVersion on any incompatible message change and raise
+// MinProtocolVersion once older clients can no longer be served.
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// MaxMessageSize is the largest single JSON line the server accepts
+const MaxMessageSize = 1024 * 1024
+
+// HelloPayload is sent by a client to open a session
+type HelloPayload struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	Client          string `json:"client,omitempty"` // e.g. "qml", "cli"
+}
+
+// HelloReplyPayload describes what the daemon supports
+type HelloReplyPayload struct {
+	ProtocolVersion    int      `json:"protocol_version"`
+	MinProtocolVersion int      `json:"min_protocol_version"`
+	DaemonVersion      string   `json:"daemon_version"`
+	MessageTypes       []string `json:"message_types"`
+	Features           Features `json:"features"`
+	Limits             Limits   `json:"limits"`
+}
+
+// Features reports capabilities of the active provider
+type Features struct {
+	Streaming   bool `json:"streaming"`
+	Attachments bool `json:"attachments"`
+	Images      bool `json:"images"`
+	Tools       bool `json:"tools"`
+}
+
+// Limits reports size limits enforced by the daemon
+type Limits struct {
+	MaxMessageBytes int `json:"max_message_bytes"`
+	MaxInputChars   int `json:"max_input_chars"`
+	MaxAttachments  int `json:"max_attachments"`
+	MaxAttachmentKB int `json:"max_attachment_kb"` // Text per attachment
+}
+
+// SupportsVersion reports whether a client protocol version can be served
+func SupportsVersion(version int) bool {
+	return version >= MinProtocolVersion && version <= ProtocolVersion
+}
@@ -6,11 +6,13 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,25 +21,39 @@ import (
 // Message types for IPC protocol
 const (
 	// Requests (UI → Daemon)
-	TypeChat        = "chat"         // Send message
-	TypeNewConv     = "new_conv"     // Create conversation
-	TypeLoadConv    = "load_conv"    // Load conversation
-	TypeDeleteConv  = "delete_conv"  // Delete conversation
-	TypeListConvs   = "list_convs"   // Get all conversations
-	TypeSetProvider = "set_provider" // Switch provider
-	TypeSetModel    = "set_model"    // Change model
-	TypeCancel      = "cancel"       // Cancel current request
-	TypeRetry       = "retry"        // Retry failed request
+	TypeChat         = "chat"          // Send message
+	TypeNewConv      = "new_conv"      // Create conversation
+	TypeLoadConv     = "load_conv"     // Load conversation
+	TypeDeleteConv   = "delete_conv"   // Delete conversation
+	TypeListConvs    = "list_convs"    // Get all conversations
+	TypeUpdateConv   = "update_conv"   // Rename, archive or pin conversation
+	TypeSearchConvs  = "search_convs"  // Full-text search
+	TypeSetProvider  = "set_provider"  // Switch provider
+	TypeSetModel     = "set_model"     // Change model
+	TypeCancel       = "cancel"        // Cancel current request
+	TypeRetry        = "retry"         // Retry failed request
+	TypeEditMessage  = "edit_message"  // Edit a prompt on a new branch
+	TypeRegenerate   = "regenerate"    // Another version of a reply
+	TypeSwitchBranch = "switch_branch" // Continue from another branch
+	TypeSubscribe    = "subscribe"     // Receive a conversation's stream
+	TypeUnsubscribe  = "unsubscribe"   // Stop receiving a conversation's stream
+	TypePing         = "ping"          // Liveness check
+	TypeHello        = "hello"         // Protocol handshake
+	TypeMonitor      = "monitor"       // Mirror all traffic to this client
 
 	// Responses (Daemon → UI)
 	TypeChatChunk    = "chat_chunk"    // Streaming chunk
 	TypeChatComplete = "chat_complete" // Stream done
 	TypeError        = "error"         // Error occurred
 	TypeStatus       = "status"        // Status update
-	TypeHeartbeat    = "heartbeat"     // Keep-alive
+	TypeHeartbeat    = "heartbeat"     // Keep-alive, answered with a pong
 	TypeConvList     = "conv_list"     // Conversations list
 	TypeConvData     = "conv_data"     // Conversation loaded
+	TypeSearchResult = "search_result" // Search matches
 	TypeAck          = "ack"           // Request acknowledged
+	TypePong         = "pong"          // Reply to ping or heartbeat
+	TypeQueued       = "queued"        // Request waiting for its turn
+	TypeMonitorEvent = "monitor_event" // Mirrored message (monitor clients)
 )
 
 // Message is the base IPC message format
@@ -97,6 +113,7 @@ const (
 	ErrCodeCancelled    = "CANCELLED"
 	ErrCodeLocalNoModel = "LOCAL_NO_MODEL"
 	ErrCodeInternal     = "INTERNAL_ERROR"
+	ErrCodeSlowClient   = "SLOW_CLIENT"
 )
 
 // ChatPayload for chat requests
@@ -114,19 +131,131 @@ type ChatChunkPayload struct {
 	Done           bool   `json:"done"`
 }
 
+// ChatCompletePayload is sent once a reply has been stored
+type ChatCompletePayload struct {
+	ConversationID string     `json:"conversation_id"`
+	MessageID      string     `json:"message_id"`
+	ContentHash    string     `json:"content_hash"` // SHA-256 of the full content, hex
+	ContentLength  int        `json:"content_length"`
+	FinishReason   string     `json:"finish_reason,omitempty"`
+	Model          string     `json:"model"`
+	Provider       string     `json:"provider"`
+	Usage          TokenUsage `json:"usage"`
+	LatencyMs      int64      `json:"latency_ms"`
+	Version        int        `json:"version,omitempty"`  // 1-based position among the reply's versions
+	Versions       int        `json:"versions,omitempty"` // Number of versions of the reply
+}
+
+// TokenUsage reports token consumption for a reply
+type TokenUsage struct {
+	Prompt     int `json:"prompt"`
+	Completion int `json:"completion"`
+	Total      int `json:"total"`
+}
+
+// QueuedPayload tells a client its request is waiting to run
+type QueuedPayload struct {
+	ConversationID string `json:"conversation_id"`
+	Position       int    `json:"position"` // 1 = next to run
+	Reason         string `json:"reason"`   // "conversation" or "global"
+}
+
+// CancelPayload for cancel requests.
+// Either RequestID or ConversationID must be set.
+type CancelPayload struct {
+	RequestID      string `json:"request_id,omitempty"`      // Cancel a single chat request
+	ConversationID string `json:"conversation_id,omitempty"` // Cancel all requests for a conversation
+}
+
+// RetryPayload for retry requests
+type RetryPayload struct {
+	ConversationID string `json:"conversation_id"`
+}
+
+// EditMessagePayload for edit_message requests
+type EditMessagePayload struct {
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"` // User message to replace
+	Content        string `json:"content"`
+}
+
+// RegeneratePayload for regenerate requests
+type RegeneratePayload struct {
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id,omitempty"` // Reply to redo; default the last one
+}
+
+// SwitchBranchPayload for switch_branch requests
+type SwitchBranchPayload struct {
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`        // Continue below this message
+	Version        int    `json:"version,omitempty"` // Or below its n-th sibling (1-based)
+}
+
+// SetProviderPayload for set_provider requests
+type SetProviderPayload struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"` // Optional model for the new provider
+}
+
+// SetModelPayload for set_model requests
+type SetModelPayload struct {
+	Model string `json:"model"`
+}
+
 // ConversationPayload for conversation operations
 type ConversationPayload struct {
 	ID    string `json:"id"`
 	Title string `json:"title,omitempty"`
 }
 
+// UpdateConvPayload for update_conv requests.
+// Fields left unset are not changed.
+type UpdateConvPayload struct {
+	ID       string  `json:"id"`
+	Title    *string `json:"title,omitempty"`
+	Archived *bool   `json:"archived,omitempty"`
+	Pinned   *bool   `json:"pinned,omitempty"`
+}
+
+// ListConvsPayload for list_convs requests (optional)
+type ListConvsPayload struct {
+	Archived string `json:"archived,omitempty"` // "exclude" (default), "include" or "only"
+	Limit    int    `json:"limit,omitempty"`    // Default 50, max 500
+}
+
+// SearchConvsPayload for search_convs requests
+type SearchConvsPayload struct {
+	Query           string `json:"query"`
+	Limit           int    `json:"limit,omitempty"` // Default 20, max 100
+	IncludeArchived bool   `json:"include_archived,omitempty"`
+}
+
 // StatusPayload for daemon status
 type StatusPayload struct {
-	Running       bool   `json:"running"`
-	Provider      string `json:"provider"`
-	Model         string `json:"model"`
-	Conversations int    `json:"conversations"`
-	IdleSeconds   int    `json:"idle_seconds"`
+	Running       bool     `json:"running"`
+	Version       string   `json:"version,omitempty"`
+	Provider      string   `json:"provider"`
+	Model         string   `json:"model"`
+	Providers     []string `json:"providers,omitempty"` // Available providers
+	Conversations int      `json:"conversations"`
+	IdleSeconds   int      `json:"idle_seconds"` // Until idle shutdown
+
+	UptimeSeconds  int            `json:"uptime_seconds"`
+	IdleForSeconds int            `json:"idle_for_seconds"` // Since last activity
+	Circuit        string         `json:"circuit"`          // "closed", "open" or "half-open"
+	InFlight       int            `json:"in_flight"`        // Requests running or queued
+	Clients        int            `json:"clients"`
+	DBSizeBytes    int64          `json:"db_size_bytes"`
+	LastError      *LastErrorInfo `json:"last_error,omitempty"`
+}
+
+// LastErrorInfo describes the most recent provider failure
+type LastErrorInfo struct {
+	Provider string `json:"provider"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message"`
+	At       int64  `json:"at"` // Unix milliseconds
 }
 
 // HeartbeatPayload for keep-alive
@@ -139,21 +268,38 @@ type Client struct {
 	id     string
 	conn   net.Conn
 	server *Server
-	sendCh chan *Message
+	out    *outbox
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// Heartbeat tracking
+	heartbeatPending atomic.Bool
+	missedHeartbeats atomic.Int32
 }
 
 // Server handles IPC connections
 type Server struct {
 	socketPath string
 	listener   net.Listener
+	activated  bool // Listener inherited from systemd
 	clients    map[string]*Client
 	clientsMu  sync.RWMutex
 	handler    MessageHandler
 	ctx        context.Context
 	cancel     context.CancelFunc
 	wg         sync.WaitGroup
+
+	// Conversation ID -> client ID -> subscribed client
+	subs   map[string]map[string]*Client
+	subsMu sync.RWMutex
+
+	// Client ID -> traffic monitor
+	monitors   map[string]*monitor
+	monitorsMu sync.RWMutex
+	monitoring atomic.Int32 // len(monitors), read without the lock
+
+	// Called for every client request (used for idle tracking)
+	onActivity func()
 }
 
 // MessageHandler processes incoming messages
@@ -161,22 +307,29 @@ type MessageHandler interface {
 	HandleMessage(ctx context.Context, client *Client, msg *Message) error
 }
 
-// NewServer creates a new IPC server
-func NewServer(socketPath string, handler MessageHandler) (*Server, error) {
-	// Remove existing socket file
-	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
-		return nil, fmt.Errorf("remove old socket: %w", err)
-	}
+// Preparer is implemented by handlers that must see requests in the
+// order they were read (e.g. to queue chat turns) before handling them
+// concurrently. Prepare runs on the reading goroutine and must not block;
+// the context it returns is passed to HandleMessage.
+type Preparer interface {
+	Prepare(ctx context.Context, client *Client, msg *Message) context.Context
+}
 
-	listener, err := net.Listen("unix", socketPath)
+// NewServer creates a new IPC server.
+// If the process was started by systemd socket activation the inherited
+// listener is used; otherwise the server binds socketPath itself.
+func NewServer(socketPath string, handler MessageHandler) (*Server, error) {
+	listener, err := activationListener()
 	if err != nil {
-		return nil, fmt.Errorf("listen: %w", err)
+		return nil, err
 	}
 
-	// Set socket permissions (owner only)
-	if err := os.Chmod(socketPath, 0600); err != nil {
-		listener.Close()
-		return nil, fmt.Errorf("chmod socket: %w", err)
+	activated := listener != nil
+	if !activated {
+		listener, err = listenUnix(socketPath)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -184,18 +337,31 @@ func NewServer(socketPath string, handler MessageHandler) (*Server, error) {
 	return &Server{
 		socketPath: socketPath,
 		listener:   listener,
+		activated:  activated,
 		clients:    make(map[string]*Client),
+		subs:       make(map[string]map[string]*Client),
+		monitors:   make(map[string]*monitor),
 		handler:    handler,
 		ctx:        ctx,
 		cancel:     cancel,
 	}, nil
 }
 
+// OnActivity sets a callback invoked for every client request.
+// Must be called before Start.
+func (s *Server) OnActivity(fn func()) {
+	s.onActivity = fn
+}
+
 // Start begins accepting connections
 func (s *Server) Start() {
 	s.wg.Add(1)
 	go s.acceptLoop()
-	log.Printf("IPC server listening on %s", s.socketPath)
+	if s.activated {
+		log.Printf("IPC server listening on %s (socket activated)", s.listener.Addr())
+	} else {
+		log.Printf("IPC server listening on %s", s.socketPath)
+	}
 }
 
 // Stop gracefully shuts down the server
@@ -214,8 +380,10 @@ func (s *Server) Stop() error {
 
 	s.wg.Wait()
 
-	// Remove socket file
-	os.Remove(s.socketPath)
+	// Remove socket file (systemd owns it when socket activated)
+	if !s.activated {
+		os.Remove(s.socketPath)
+	}
 
 	log.Printf("IPC server stopped")
 	return nil
@@ -237,6 +405,12 @@ func (s *Server) acceptLoop() {
 			}
 		}
 
+		if err := checkPeer(conn); err != nil {
+			log.Printf("IPC connection rejected: %v", err)
+			conn.Close()
+			continue
+		}
+
 		client := s.newClient(conn)
 		s.wg.Add(2)
 		go s.handleClient(client)
@@ -251,7 +425,7 @@ func (s *Server) newClient(conn net.Conn) *Client {
 		id:     uuid.New().String(),
 		conn:   conn,
 		server: s,
-		sendCh: make(chan *Message, 100),
+		out:    newOutbox(),
 		ctx:    ctx,
 		cancel: cancel,
 	}
@@ -272,7 +446,7 @@ func (s *Server) handleClient(client *Client) {
 
 	scanner := bufio.NewScanner(client.conn)
 	// Increase buffer size for large messages
-	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner.Buffer(make([]byte, 64*1024), MaxMessageSize)
 
 	for scanner.Scan() {
 		select {
@@ -293,12 +467,16 @@ func (s *Server) handleClient(client *Client) {
 			continue
 		}
 
+		// Any inbound message proves the client is alive
+		client.markAlive()
+
+		if s.handleInline(client, &msg) {
+			continue
+		}
+
 		// Handle message in goroutine to not block reading
-		go func(m Message) {
-			if err := s.handler.HandleMessage(client.ctx, client, &m); err != nil {
-				log.Printf("IPC handler error: %v", err)
-			}
-		}(msg)
+		ctx := s.prepare(client, &msg)
+		go s.dispatch(ctx, client, &msg)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -306,28 +484,73 @@ func (s *Server) handleClient(client *Client) {
 	}
 }
 
+// handleInline answers requests that the server handles itself.
+// Returns false if the message must go to the handler.
+func (s *Server) handleInline(client *Client, msg *Message) bool {
+	s.mirror(client, DirectionIn, msg)
+
+	// Pings and pongs don't count as activity
+	if s.handlePing(client, msg) {
+		return true
+	}
+
+	// Everything else except status polling is a real request
+	if s.onActivity != nil && !isPassive(msg.Type) {
+		s.onActivity()
+	}
+
+	return s.handleSubscription(client, msg) || s.handleMonitor(client, msg)
+}
+
+// isPassive reports whether a request only observes the daemon.
+// Status bars poll these, so they must not keep the daemon alive.
+func isPassive(msgType string) bool {
+	return msgType == TypeStatus || msgType == TypeHello || msgType == TypeMonitor
+}
+
+// prepare builds the context of a request, letting the handler act on
+// it in read order
+func (s *Server) prepare(client *Client, msg *Message) context.Context {
+	ctx := withRequest(client.ctx, client, msg.RequestID)
+	if p, ok := s.handler.(Preparer); ok {
+		ctx = p.Prepare(ctx, client, msg)
+	}
+	return ctx
+}
+
+// dispatch passes a request to the message handler
+func (s *Server) dispatch(ctx context.Context, client *Client, msg *Message) {
+	if err := s.handler.HandleMessage(ctx, client, msg); err != nil {
+		log.Printf("IPC handler error: %v", err)
+	}
+}
+
 // writeLoop handles sending messages to a client
 func (s *Server) writeLoop(client *Client) {
 	defer s.wg.Done()
 
 	for {
-		select {
-		case <-client.ctx.Done():
-			return
-		case msg := <-client.sendCh:
-			data, err := json.Marshal(msg)
-			if err != nil {
-				log.Printf("IPC marshal error: %v", err)
-				continue
+		msg, err := client.out.pop(client.ctx)
+		if err != nil {
+			if errors.Is(err, errOutboxFailed) {
+				client.close() // Final error delivered, drop the slow client
 			}
+			return
+		}
 
-			// Write message + newline
-			data = append(data, '\n')
-			if _, err := client.conn.Write(data); err != nil {
-				log.Printf("IPC write error to %s: %v", client.id, err)
-				client.cancel()
-				return
-			}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("IPC marshal error: %v", err)
+			continue
+		}
+
+		// Write message + newline
+		data = append(data, '\n')
+		client.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := client.conn.Write(data); err != nil {
+			log.Printf("IPC write error to %s: %v", client.id, err)
+			client.close()
+			return
 		}
 	}
 }
@@ -337,23 +560,35 @@ func (s *Server) removeClient(client *Client) {
 	s.clientsMu.Lock()
 	delete(s.clients, client.id)
 	s.clientsMu.Unlock()
-	close(client.sendCh)
+	s.unsubscribeAll(client)
+	s.removeMonitor(client)
+	client.out.close()
 	log.Printf("IPC client disconnected: %s", client.id)
 }
 
-// Send queues a message to be sent to the client (safe for closed channel)
+// Send queues a message to be sent to the client.
+// Stream data is never dropped: while the client lags, chunks of the same
+// message are merged. A client that stays too far behind receives a final
+// SLOW_CLIENT error and is disconnected.
 func (c *Client) Send(msg *Message) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("IPC send recovered from panic for %s: %v", c.id, r)
-		}
-	}()
+	c.server.mirror(c, DirectionOut, msg)
 
-	select {
-	case c.sendCh <- msg:
-	default:
-		log.Printf("IPC send buffer full or closed for %s, dropping message", c.id)
+	if c.out.push(msg) {
+		return
 	}
+	c.dropSlow()
+}
+
+// dropSlow replaces a lagging client's queue with a final error, after
+// which it is disconnected
+func (c *Client) dropSlow() {
+	log.Printf("IPC client %s fell too far behind, disconnecting", c.id)
+	final, _ := NewMessage(TypeError, ErrorPayload{
+		Code:      ErrCodeSlowClient,
+		Message:   "Client fell too far behind the stream",
+		Retryable: true,
+	})
+	c.out.fail(final)
 }
 
 // SendPayload is a convenience method to send a typed payload
@@ -376,6 +611,18 @@ func (s *Server) Broadcast(msg *Message) {
 	}
 }
 
+// BroadcastExcept sends a message to all connected clients except one
+func (s *Server) BroadcastExcept(msg *Message, except *Client) {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+
+	for _, client := range s.clients {
+		if client != except {
+			client.Send(msg)
+		}
+	}
+}
+
 // sendError sends an error response to a client
 func (s *Server) sendError(client *Client, requestID string, code string, message string, retryable bool) {
 	msg, _ := NewMessage(TypeError, ErrorPayload{
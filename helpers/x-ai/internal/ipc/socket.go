@@ -0,0 +1,89 @@
+// Package ipc - Unix socket setup
+package ipc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// listenUnix binds a fresh Unix socket at socketPath
+func listenUnix(socketPath string) (net.Listener, error) {
+	if err := prepareSocketDir(filepath.Dir(socketPath)); err != nil {
+		return nil, err
+	}
+
+	if err := removeStaleSocket(socketPath); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	// Set socket permissions (owner only)
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+
+	return listener, nil
+}
+
+// prepareSocketDir creates the socket directory (owner only) and refuses
+// one that is not private to us, since whoever controls the directory can
+// swap the socket for their own
+func prepareSocketDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("create socket dir: %w", err)
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("stat socket dir: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("socket dir %s is not a directory", dir)
+	}
+
+	if uid, ok := fileOwner(info); ok && uid != os.Getuid() {
+		return fmt.Errorf("socket dir %s is owned by uid %d", dir, uid)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("socket dir %s has mode %04o, want 0700", dir, perm)
+	}
+	return nil
+}
+
+// removeStaleSocket removes a socket left behind by a dead daemon.
+// It refuses to touch anything that is not our own socket, and fails
+// if a daemon is still answering on it.
+func removeStaleSocket(socketPath string) error {
+	info, err := os.Lstat(socketPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat socket: %w", err)
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("refusing to replace %s: not a socket", socketPath)
+	}
+	if uid, ok := fileOwner(info); ok && uid != os.Getuid() {
+		return fmt.Errorf("refusing to replace %s: owned by uid %d", socketPath, uid)
+	}
+
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("daemon already running on %s", socketPath)
+	}
+
+	if err := os.Remove(socketPath); err != nil {
+		return fmt.Errorf("remove old socket: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Package ipc - per-conversation stream subscriptions
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// SubscribePayload for subscribe/unsubscribe requests
+type SubscribePayload struct {
+	ConversationID string `json:"conversation_id"`
+}
+
+// requestKey is the context key for request metadata
+type requestKey struct{}
+
+// requestInfo identifies who sent a request
+type requestInfo struct {
+	client    *Client
+	requestID string
+}
+
+// withRequest attaches the originating client and request ID to a context
+func withRequest(ctx context.Context, client *Client, requestID string) context.Context {
+	return context.WithValue(ctx, requestKey{}, requestInfo{client: client, requestID: requestID})
+}
+
+// ClientFromContext returns the client that sent the request, if any
+func ClientFromContext(ctx context.Context) *Client {
+	info, _ := ctx.Value(requestKey{}).(requestInfo)
+	return info.client
+}
+
+// RequestIDFromContext returns the ID of the request being handled, if any
+func RequestIDFromContext(ctx context.Context) string {
+	info, _ := ctx.Value(requestKey{}).(requestInfo)
+	return info.requestID
+}
+
+// handleSubscription processes subscribe/unsubscribe messages.
+// Returns false if the message is not a subscription request.
+func (s *Server) handleSubscription(client *Client, msg *Message) bool {
+	if msg.Type != TypeSubscribe && msg.Type != TypeUnsubscribe {
+		return false
+	}
+
+	var payload SubscribePayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.ConversationID == "" {
+		s.sendError(client, msg.RequestID, ErrCodeInvalidReq, "conversation_id is required", false)
+		return true
+	}
+
+	if msg.Type == TypeSubscribe {
+		s.subscribe(client, payload.ConversationID)
+	} else {
+		s.unsubscribe(client, payload.ConversationID)
+	}
+
+	ack, _ := msg.Response(TypeAck, payload)
+	client.Send(ack)
+	return true
+}
+
+// subscribe adds a client to a conversation's subscribers
+func (s *Server) subscribe(client *Client, conversationID string) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	subs, ok := s.subs[conversationID]
+	if !ok {
+		subs = make(map[string]*Client)
+		s.subs[conversationID] = subs
+	}
+	subs[client.id] = client
+	log.Printf("IPC client %s subscribed to %s", client.id, conversationID)
+}
+
+// unsubscribe removes a client from a conversation's subscribers
+func (s *Server) unsubscribe(client *Client, conversationID string) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	if subs, ok := s.subs[conversationID]; ok {
+		delete(subs, client.id)
+		if len(subs) == 0 {
+			delete(s.subs, conversationID)
+		}
+	}
+}
+
+// unsubscribeAll removes a client from every conversation
+func (s *Server) unsubscribeAll(client *Client) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	for convID, subs := range s.subs {
+		delete(subs, client.id)
+		if len(subs) == 0 {
+			delete(s.subs, convID)
+		}
+	}
+}
+
+// Publish sends a conversation message to the client that made the
+// request (taken from ctx) and to every subscriber of the conversation.
+// Each client receives the message at most once.
+func (s *Server) Publish(ctx context.Context, conversationID string, msg *Message) {
+	origin := ClientFromContext(ctx)
+	if origin != nil {
+		origin.Send(msg)
+	}
+
+	s.subsMu.RLock()
+	defer s.subsMu.RUnlock()
+
+	for _, client := range s.subs[conversationID] {
+		if client != origin {
+			client.Send(msg)
+		}
+	}
+}
+
+// SubscriptionCount returns the number of active subscriptions
+func (s *Server) SubscriptionCount() int {
+	s.subsMu.RLock()
+	defer s.subsMu.RUnlock()
+
+	count := 0
+	for _, subs := range s.subs {
+		count += len(subs)
+	}
+	return count
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/genai"
@@ -15,6 +16,7 @@ import (
 type GeminiProvider struct {
 	client    *genai.Client
 	model     string
+	modelMu   sync.RWMutex
 	maxTokens int
 	timeout   time.Duration
 }
@@ -43,7 +45,7 @@ func NewGeminiProvider(ctx context.Context, cfg GeminiConfig) (*GeminiProvider,
 		cfg.Model = "gemini-2.5-flash"
 	}
 	if cfg.MaxTokens == 0 {
-		cfg.MaxTokens = 4096
+		cfg.MaxTokens = DefaultMaxTokens
 	}
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 60 * time.Second
@@ -77,6 +79,32 @@ func (p *GeminiProvider) Name() string {
 	return "gemini"
 }
 
+// Capabilities reports supported features.
+// Responses are generated in one call and replayed to the stream callback.
+func (p *GeminiProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Attachments: true,
+		Images:      true,
+	}
+}
+
+// geminiParts maps message parts to Gemini parts (images as inline data)
+func geminiParts(msg Message) []*genai.Part {
+	parts := msg.ContentParts()
+	out := make([]*genai.Part, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case PartImage:
+			out = append(out, &genai.Part{
+				InlineData: &genai.Blob{Data: part.Data, MIMEType: part.MimeType},
+			})
+		default:
+			out = append(out, &genai.Part{Text: part.Text})
+		}
+	}
+	return out
+}
+
 // Chat sends a message and streams the response
 func (p *GeminiProvider) Chat(ctx context.Context, req *ChatRequest, stream StreamCallback) (*ChatResponse, error) {
 	// Create timeout context
@@ -96,7 +124,7 @@ func (p *GeminiProvider) Chat(ctx context.Context, req *ChatRequest, stream Stre
 		}
 
 		contents = append(contents, &genai.Content{
-			Parts: []*genai.Part{{Text: msg.Content}},
+			Parts: geminiParts(msg),
 			Role:  role,
 		})
 	}
@@ -104,7 +132,7 @@ func (p *GeminiProvider) Chat(ctx context.Context, req *ChatRequest, stream Stre
 	// Determine model
 	model := req.Model
 	if model == "" {
-		model = p.model
+		model = p.GetModel()
 	}
 
 	// Determine max tokens
@@ -188,9 +216,19 @@ func (p *GeminiProvider) Chat(ctx context.Context, req *ChatRequest, stream Stre
 		}
 	}
 
+	var usage TokenUsage
+	if result.UsageMetadata != nil {
+		usage = TokenUsage{
+			Prompt:     int(result.UsageMetadata.PromptTokenCount),
+			Completion: int(result.UsageMetadata.CandidatesTokenCount),
+			Total:      int(result.UsageMetadata.TotalTokenCount),
+		}
+	}
+
 	return &ChatResponse{
 		Content:      fullContent.String(),
 		Model:        model,
+		TokensUsed:   usage,
 		FinishReason: finishReason,
 	}, nil
 }
@@ -198,7 +236,7 @@ func (p *GeminiProvider) Chat(ctx context.Context, req *ChatRequest, stream Stre
 // ValidateConnection checks if Gemini is reachable
 func (p *GeminiProvider) ValidateConnection(ctx context.Context) error {
 	// Simple test - generate a tiny response
-	_, err := p.client.Models.GenerateContent(ctx, p.model, genai.Text("hi"), &genai.GenerateContentConfig{
+	_, err := p.client.Models.GenerateContent(ctx, p.GetModel(), genai.Text("hi"), &genai.GenerateContentConfig{
 		MaxOutputTokens: 1,
 	})
 	if err != nil {
@@ -261,7 +299,7 @@ func (p *GeminiProvider) wrapError(err error) error {
 
 	// Check for context cancellation
 	if errors.Is(err, context.Canceled) {
-		pe.Code = "CANCELLED"
+		pe.Code = ErrCodeCancelled
 		pe.Message = "Request cancelled"
 		pe.Retryable = false
 		return pe
@@ -284,10 +322,19 @@ func (p *GeminiProvider) wrapError(err error) error {
 
 // SetModel changes the default model
 func (p *GeminiProvider) SetModel(model string) {
+	p.modelMu.Lock()
 	p.model = model
+	p.modelMu.Unlock()
 }
 
 // GetModel returns the current model
 func (p *GeminiProvider) GetModel() string {
+	p.modelMu.RLock()
+	defer p.modelMu.RUnlock()
 	return p.model
 }
+
+// MaxOutputTokens returns the default reply length limit
+func (p *GeminiProvider) MaxOutputTokens() int {
+	return p.maxTokens
+}
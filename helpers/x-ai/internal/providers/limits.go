@@ -0,0 +1,62 @@
+// Package providers - model context windows and output limits
+package providers
+
+import "strings"
+
+// Fallbacks for models missing from the table and providers that do not
+// report their output limit
+const (
+	DefaultContextWindow = 8192
+	DefaultMaxTokens     = 4096
+)
+
+// contextWindows maps model name prefixes to their context window in
+// tokens. The longest matching prefix wins, so dated snapshots
+// (gpt-4o-2024-08-06) and tags (llama3.2:3b) resolve to their family.
+var contextWindows = map[string]int{
+	// OpenAI
+	"gpt-4o":        128000,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-4.1":       1047576,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o3":            200000,
+	"o4-mini":       200000,
+
+	// Gemini
+	"gemini-2.5":       1048576,
+	"gemini-2.0-flash": 1048576,
+	"gemini-1.5-flash": 1048576,
+	"gemini-1.5-pro":   2097152,
+
+	// Ollama (default num_ctx of the server, not the model maximum)
+	"llama3": 8192,
+}
+
+// ContextWindow returns the context window of a model in tokens
+func ContextWindow(model string) int {
+	model = strings.TrimPrefix(strings.ToLower(model), "models/")
+
+	window, matched := DefaultContextWindow, 0
+	for prefix, size := range contextWindows {
+		if len(prefix) > matched && strings.HasPrefix(model, prefix) {
+			window, matched = size, len(prefix)
+		}
+	}
+	return window
+}
+
+// OutputLimiter is implemented by providers that cap reply length
+type OutputLimiter interface {
+	MaxOutputTokens() int
+}
+
+// MaxOutputTokens returns the reply length a provider asks for, which
+// must be left free in the context window
+func MaxOutputTokens(p Provider) int {
+	if ol, ok := p.(OutputLimiter); ok && ol.MaxOutputTokens() > 0 {
+		return ol.MaxOutputTokens()
+	}
+	return DefaultMaxTokens
+}
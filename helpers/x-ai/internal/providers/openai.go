@@ -3,11 +3,13 @@ package providers
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -17,6 +19,7 @@ import (
 type OpenAIProvider struct {
 	client    *openai.Client
 	model     string
+	modelMu   sync.RWMutex
 	maxTokens int
 	timeout   time.Duration
 }
@@ -46,7 +49,7 @@ func NewOpenAIProvider(cfg OpenAIConfig) (*OpenAIProvider, error) {
 		cfg.Model = "gpt-4o-mini"
 	}
 	if cfg.MaxTokens == 0 {
-		cfg.MaxTokens = 4096
+		cfg.MaxTokens = DefaultMaxTokens
 	}
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 60 * time.Second
@@ -78,6 +81,50 @@ func (p *OpenAIProvider) Name() string {
 	return "openai"
 }
 
+// Capabilities reports supported features
+func (p *OpenAIProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Streaming:   true,
+		Attachments: true,
+		Images:      true,
+	}
+}
+
+// openaiMessage maps a message to the OpenAI format. Messages with
+// parts use MultiContent, with images sent as base64 data URLs.
+func openaiMessage(msg Message) openai.ChatCompletionMessage {
+	if len(msg.Parts) == 0 {
+		return openai.ChatCompletionMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+	}
+
+	parts := make([]openai.ChatMessagePart, 0, len(msg.Parts))
+	for _, part := range msg.Parts {
+		switch part.Type {
+		case PartImage:
+			parts = append(parts, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{
+					URL:    "data:" + part.MimeType + ";base64," + base64.StdEncoding.EncodeToString(part.Data),
+					Detail: openai.ImageURLDetailAuto,
+				},
+			})
+		default:
+			parts = append(parts, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: part.Text,
+			})
+		}
+	}
+
+	return openai.ChatCompletionMessage{
+		Role:         msg.Role,
+		MultiContent: parts,
+	}
+}
+
 // Chat sends a message and streams the response
 func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest, stream StreamCallback) (*ChatResponse, error) {
 	// Build messages array
@@ -93,16 +140,13 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest, stream Stre
 
 	// Add conversation messages
 	for _, msg := range req.Messages {
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
+		messages = append(messages, openaiMessage(msg))
 	}
 
 	// Determine model
 	model := req.Model
 	if model == "" {
-		model = p.model
+		model = p.GetModel()
 	}
 
 	// Determine max tokens
@@ -124,6 +168,9 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest, stream Stre
 		MaxTokens:   maxTokens,
 		Temperature: float32(temperature),
 		Stream:      true,
+		StreamOptions: &openai.StreamOptions{
+			IncludeUsage: true, // Usage arrives in the final chunk
+		},
 	}
 
 	// Start streaming
@@ -136,6 +183,7 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest, stream Stre
 	// Collect full response while streaming
 	var fullContent strings.Builder
 	var finishReason string
+	var usage TokenUsage
 
 	for {
 		chunk, err := streamResp.Recv()
@@ -146,6 +194,15 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest, stream Stre
 			return nil, p.wrapError(err)
 		}
 
+		// Usage-only chunk (no choices) when include_usage is set
+		if chunk.Usage != nil {
+			usage = TokenUsage{
+				Prompt:     chunk.Usage.PromptTokens,
+				Completion: chunk.Usage.CompletionTokens,
+				Total:      chunk.Usage.TotalTokens,
+			}
+		}
+
 		// Extract content delta
 		if len(chunk.Choices) > 0 {
 			delta := chunk.Choices[0].Delta.Content
@@ -182,8 +239,8 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest, stream Stre
 	return &ChatResponse{
 		Content:      fullContent.String(),
 		Model:        model,
+		TokensUsed:   usage,
 		FinishReason: finishReason,
-		// Note: Token usage not available in streaming mode
 	}, nil
 }
 
@@ -283,7 +340,7 @@ func (p *OpenAIProvider) wrapError(err error) error {
 	if errors.Is(err, context.Canceled) {
 		return &ProviderError{
 			Provider:  "openai",
-			Code:      "CANCELLED",
+			Code:      ErrCodeCancelled,
 			Message:   "Request cancelled",
 			Retryable: false,
 			Original:  err,
@@ -313,10 +370,19 @@ func (p *OpenAIProvider) wrapError(err error) error {
 
 // SetModel changes the default model
 func (p *OpenAIProvider) SetModel(model string) {
+	p.modelMu.Lock()
 	p.model = model
+	p.modelMu.Unlock()
 }
 
 // GetModel returns the current model
 func (p *OpenAIProvider) GetModel() string {
+	p.modelMu.RLock()
+	defer p.modelMu.RUnlock()
 	return p.model
 }
+
+// MaxOutputTokens returns the default reply length limit
+func (p *OpenAIProvider) MaxOutputTokens() int {
+	return p.maxTokens
+}
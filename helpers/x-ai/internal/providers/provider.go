@@ -21,6 +21,27 @@ type Provider interface {
 	ListModels(ctx context.Context) ([]Model, error)
 }
 
+// Capabilities describes optional features a provider supports
+type Capabilities struct {
+	Streaming   bool // Delivers tokens incrementally
+	Attachments bool // Accepts text attachments
+	Images      bool // Accepts image input
+	Tools       bool // Supports tool/function calling
+}
+
+// CapabilityReporter is implemented by providers that report their features
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns a provider's capabilities (none if unreported)
+func CapabilitiesOf(p Provider) Capabilities {
+	if cr, ok := p.(CapabilityReporter); ok {
+		return cr.Capabilities()
+	}
+	return Capabilities{}
+}
+
 // StreamCallback is called for each chunk of a streaming response
 type StreamCallback func(chunk *StreamChunk) error
 
@@ -72,8 +93,32 @@ type TokenUsage struct {
 
 // Message represents a single message in conversation
 type Message struct {
-	Role    string `json:"role"`    // "system", "user", "assistant"
-	Content string `json:"content"` // Message text
+	Role    string `json:"role"`            // "system", "user", "assistant"
+	Content string `json:"content"`         // Message text
+	Parts   []Part `json:"parts,omitempty"` // Multimodal content (replaces Content when set)
+}
+
+// Part types
+const (
+	PartText  = "text"
+	PartImage = "image"
+)
+
+// Part is one piece of multimodal message content
+type Part struct {
+	Type     string `json:"type"`                // PartText or PartImage
+	Text     string `json:"text,omitempty"`      // Text content
+	Data     []byte `json:"data,omitempty"`      // Image bytes
+	MimeType string `json:"mime_type,omitempty"` // Image MIME type
+}
+
+// ContentParts returns the message as parts, wrapping plain Content
+// in a single text part
+func (m Message) ContentParts() []Part {
+	if len(m.Parts) > 0 {
+		return m.Parts
+	}
+	return []Part{{Type: PartText, Text: m.Content}}
 }
 
 // Model represents an available AI model
@@ -110,5 +155,6 @@ const (
 	ErrCodeInvalidReq        = "INVALID_REQUEST"
 	ErrCodeContextLen        = "CONTEXT_LENGTH"
 	ErrCodeTimeout           = "TIMEOUT"
+	ErrCodeCancelled         = "CANCELLED"
 	ErrCodeModelNotAvailable = "MODEL_NOT_AVAILABLE"
 )
@@ -0,0 +1,86 @@
+// Package providers - Registry of initialized providers
+package providers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ModelSelector is implemented by providers that can switch models at runtime
+type ModelSelector interface {
+	GetModel() string
+	SetModel(model string)
+}
+
+// Registry holds all providers that were initialized at startup
+type Registry struct {
+	providers map[string]Provider
+	order     []string
+	mu        sync.RWMutex
+}
+
+// NewRegistry creates an empty provider registry
+func NewRegistry() *Registry {
+	return &Registry{
+		providers: make(map[string]Provider),
+	}
+}
+
+// Register adds a provider, keyed by its Name()
+func (r *Registry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := p.Name()
+	if _, exists := r.providers[name]; !exists {
+		r.order = append(r.order, name)
+	}
+	r.providers[name] = p
+}
+
+// Get returns a provider by name, or nil if it is not registered
+func (r *Registry) Get(name string) Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.providers[name]
+}
+
+// Names returns registered provider names in registration order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, len(r.order))
+	copy(names, r.order)
+	return names
+}
+
+// ValidateModel checks that a model is offered by the provider
+func ValidateModel(ctx context.Context, p Provider, model string) error {
+	models, err := p.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range models {
+		if m.ID == model {
+			return nil
+		}
+	}
+
+	return &ProviderError{
+		Provider:  p.Name(),
+		Code:      ErrCodeModelNotAvailable,
+		Message:   fmt.Sprintf("model %q is not available", model),
+		Retryable: false,
+	}
+}
+
+// CurrentModel returns the provider's active model, or "" if unknown
+func CurrentModel(p Provider) string {
+	if ms, ok := p.(ModelSelector); ok {
+		return ms.GetModel()
+	}
+	return ""
+}
@@ -191,7 +191,10 @@ func (cb *CircuitBreaker) Execute(ctx context.Context, fn func(context.Context)
 	// Execute the function
 	err := fn(ctx)
 
-	// Record result
+	// Record result (a cancelled call says nothing about provider health)
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
 	if err != nil {
 		cb.recordFailure()
 	} else {
@@ -308,3 +311,8 @@ func (re *ResilientExecutor) Execute(ctx context.Context, fn RetryableFunc, isRe
 		return Retry(ctx, re.retry, fn, isRetryable)
 	})
 }
+
+// CircuitState returns the state of the underlying circuit breaker
+func (re *ResilientExecutor) CircuitState() CircuitState {
+	return re.circuit.State()
+}
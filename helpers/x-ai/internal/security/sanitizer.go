@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Sanitizer handles input sanitization
@@ -33,40 +34,60 @@ func NewSanitizer() *Sanitizer {
 	}
 }
 
-// Sanitize cleans user input
+// MaxInputLength returns the maximum accepted input length
+func (s *Sanitizer) MaxInputLength() int {
+	return s.maxInputLength
+}
+
+// Sanitize cleans user input, truncating it to the maximum length and
+// line count
 func (s *Sanitizer) Sanitize(input string) SanitizeResult {
-	result := SanitizeResult{
-		Input:    input,
-		Warnings: []Warning{},
-	}
+	var warnings []Warning
 
-	// 1. Length check
+	// 1. Length check (cut on a character boundary)
 	if len(input) > s.maxInputLength {
-		result.Input = input[:s.maxInputLength]
-		result.Warnings = append(result.Warnings, Warning{
+		cut := s.maxInputLength
+		for cut > 0 && !utf8.RuneStart(input[cut]) {
+			cut--
+		}
+		input = input[:cut]
+		warnings = append(warnings, Warning{
 			Type:    "truncated",
 			Message: "Input was truncated to maximum length",
 		})
 	}
 
-	// 2. Strip dangerous control characters (keep newlines, tabs)
-	result.Input = s.stripControlChars(result.Input)
-
-	// 3. Normalize line endings
-	result.Input = strings.ReplaceAll(result.Input, "\r\n", "\n")
-	result.Input = strings.ReplaceAll(result.Input, "\r", "\n")
-
-	// 4. Check line count
-	lines := strings.Split(result.Input, "\n")
+	// 2. Check line count
+	lines := strings.Split(input, "\n")
 	if len(lines) > s.maxLineCount {
-		result.Input = strings.Join(lines[:s.maxLineCount], "\n")
-		result.Warnings = append(result.Warnings, Warning{
+		input = strings.Join(lines[:s.maxLineCount], "\n")
+		warnings = append(warnings, Warning{
 			Type:    "lines_truncated",
 			Message: "Input was truncated to maximum line count",
 		})
 	}
 
-	// 5. Detect potential issues (warn only, don't block)
+	result := s.Clean(input)
+	result.Warnings = append(warnings, result.Warnings...)
+	return result
+}
+
+// Clean sanitizes input without limiting its size, for content that is
+// size-checked elsewhere (e.g. attachments)
+func (s *Sanitizer) Clean(input string) SanitizeResult {
+	result := SanitizeResult{
+		Input:    input,
+		Warnings: []Warning{},
+	}
+
+	// Strip dangerous control characters (keep newlines, tabs)
+	result.Input = s.stripControlChars(result.Input)
+
+	// Normalize line endings
+	result.Input = strings.ReplaceAll(result.Input, "\r\n", "\n")
+	result.Input = strings.ReplaceAll(result.Input, "\r", "\n")
+
+	// Detect potential issues (warn only, don't block)
 	if s.detectsSensitiveData(result.Input) {
 		result.Warnings = append(result.Warnings, Warning{
 			Type:    "sensitive_data",
@@ -18,6 +18,11 @@ NC='\033[0m'
 
 XSHELL_DIR="${HOME}/.gemini/antigravity/scratch/x-shell"
 DATA_DIR="${HOME}/.local/share/x-ai"
+if [ -n "$XDG_RUNTIME_DIR" ]; then
+    SOCKET_DIR="${XDG_RUNTIME_DIR}/x-ai"
+else
+    SOCKET_DIR="${TMPDIR:-/tmp}/x-ai-$(id -u)"
+fi
 
 # 1. Stop x-ai daemon
 echo -e "${YELLOW}[1/5]${NC} Stopping x-ai daemon..."
@@ -30,8 +35,9 @@ fi
 
 # 2. Remove socket file
 echo -e "${YELLOW}[2/5]${NC} Removing socket file..."
-if [ -S /tmp/x-ai.sock ]; then
-    rm -f /tmp/x-ai.sock
+if [ -S "$SOCKET_DIR/x-ai.sock" ]; then
+    rm -f "$SOCKET_DIR/x-ai.sock"
+    rmdir "$SOCKET_DIR" 2>/dev/null || true
     echo -e "  ${GREEN}✓${NC} Socket removed"
 else
     echo -e "  ${GREEN}✓${NC} Socket not found"
@@ -93,7 +99,7 @@ echo -e "${GREEN}================================${NC}"
 echo ""
 echo "What was removed:"
 echo "  • x-ai daemon process"
-echo "  • /tmp/x-ai.sock"
+echo "  • $SOCKET_DIR/x-ai.sock"
 echo "  • ~/.local/share/x-ai/ (conversation data)"
 echo "  • AI.qml disabled (stub created)"
 echo ""